@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/aligndx/aligndx/internal/config"
 	"github.com/aligndx/aligndx/internal/jobs"
 	"github.com/aligndx/aligndx/internal/logger"
 	"github.com/aligndx/aligndx/internal/nats"
@@ -21,12 +22,17 @@ func StartCommand(rootCmd *cobra.Command) *cobra.Command {
 			ctx := context.Background()
 			log := logger.NewLoggerWrapper("zerolog", ctx)
 
-			// Step 1: Start MQ
-			log.Info("Starting message queue...")
-			if err := nats.StartNATSServer(ctx, false); err != nil {
-				return err
+			// Step 1: Start MQ, unless it is kept in memory
+			cfg := config.NewConfigManager().GetConfig()
+			if cfg.MQ.Backend == config.MQBackendMemory {
+				log.Info("Using in-memory message queue; jobs and events are lost on restart")
+			} else {
+				log.Info("Starting message queue...")
+				if err := nats.StartNATSServer(ctx, false); err != nil {
+					return err
+				}
+				log.Debug("Message queue started successfully.")
 			}
-			log.Debug("Message queue started successfully.")
 
 			// Step 2: Start worker and serve concurrently
 			var wg sync.WaitGroup
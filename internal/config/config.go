@@ -26,6 +26,8 @@ type Config struct {
 	SMTP    SMTPConfig    `koanf:"smtp"`
 	S3      S3Config      `koanf:"s3"`
 	NXF     NXFConfig     `koanf:"nxf"`
+	Worker  WorkerConfig  `koanf:"worker"`
+	Archive ArchiveConfig `koanf:"archive"`
 }
 
 type LoggingConfig struct {
@@ -41,8 +43,67 @@ type APIConfig struct {
 
 // MQConfig holds configuration for the message queue
 type MQConfig struct {
-	URL    string        `koanf:"url"`
-	MaxAge time.Duration `koanf:"maxage"`
+	Backend         string        `koanf:"backend"` // "jetstream" connects to the server at URL; "memory" keeps streams in the process and needs no server
+	URL             string        `koanf:"url"`
+	MaxAge          time.Duration `koanf:"maxage"`          // Deprecated: use Events.MaxAge, which takes precedence when set
+	DuplicateWindow time.Duration `koanf:"duplicatewindow"` // How long a job published again under the same ID is dropped as a duplicate
+
+	// Stream settings, compared with the live streams at startup and updated in place where that is safe
+	Queue   StreamConfig `koanf:"queue"`   // Pending jobs
+	Events  StreamConfig `koanf:"events"`  // Job status and log events
+	DLQ     StreamConfig `koanf:"dlq"`     // Failed jobs
+	Workers StreamConfig `koanf:"workers"` // Worker heartbeats
+
+	// Authentication; set at most one of a creds file, an nkey seed file, a token or a user and password
+	CredsFile string `koanf:"credsfile"` // JWT user credentials file
+	NKeyFile  string `koanf:"nkeyfile"`  // NKey seed file
+	Token     string `koanf:"token"`
+	User      string `koanf:"user"`
+	Password  string `koanf:"password"`
+
+	// TLS
+	TLSCA   string `koanf:"tlsca"`   // CA certificate used to verify the server
+	TLSCert string `koanf:"tlscert"` // Client certificate, for servers that verify clients
+	TLSKey  string `koanf:"tlskey"`  // Client certificate key
+
+	// Reconnection
+	ConnectTimeout   time.Duration `koanf:"connecttimeout"`   // How long to wait for the initial connection
+	MaxReconnects    int           `koanf:"maxreconnects"`    // Reconnect attempts before the connection is closed (-1 retries forever)
+	ReconnectWait    time.Duration `koanf:"reconnectwait"`    // Delay before the first reconnect attempt, doubled on each further attempt
+	MaxReconnectWait time.Duration `koanf:"maxreconnectwait"` // Longest delay between reconnect attempts
+}
+
+// StreamConfig holds the retention settings of a message queue stream. Limits of zero are unlimited.
+type StreamConfig struct {
+	MaxAge   time.Duration `koanf:"maxage"`   // How long messages are kept
+	MaxBytes int64         `koanf:"maxbytes"` // Most bytes the stream stores
+	MaxMsgs  int64         `koanf:"maxmsgs"`  // Most messages the stream stores
+	Replicas int           `koanf:"replicas"` // Copies kept in a clustered server
+	Storage  string        `koanf:"storage"`  // "file" or "memory"; cannot be changed once the stream exists
+	Discard  string        `koanf:"discard"`  // At a limit, "old" drops the oldest messages and "new" rejects new ones
+}
+
+// Message queue backends selectable with MQ.Backend
+const (
+	MQBackendJetStream = "jetstream"
+	MQBackendMemory    = "memory"
+)
+
+// WorkerConfig holds configuration for job workers
+type WorkerConfig struct {
+	Concurrency       int               `koanf:"concurrency"`       // Maximum jobs a worker runs at once
+	MaxJobsPerUser    int               `koanf:"maxjobsperuser"`    // Maximum jobs running at once for one user across all workers, which learn of each other's jobs from heartbeats (0 for no limit)
+	AckWait           time.Duration     `koanf:"ackwait"`           // How long a job may go without a heartbeat before it is redelivered
+	MaxAckPending     int               `koanf:"maxackpending"`     // Maximum unacknowledged jobs on each priority lane across all workers, which share the lane consumers (0 uses the server default)
+	CPUs              int               `koanf:"cpus"`              // CPUs a worker may reserve for jobs (0 detects them)
+	MemoryGB          int               `koanf:"memorygb"`          // Memory in GB a worker may reserve for jobs (0 detects available memory)
+	ID                string            `koanf:"id"`                // Worker ID reported in heartbeats (empty generates one from the hostname)
+	Labels            map[string]string `koanf:"labels"`            // Free-form labels reported in heartbeats
+	HeartbeatInterval time.Duration     `koanf:"heartbeatinterval"` // How often a worker publishes a heartbeat
+	StaleAfter        time.Duration     `koanf:"staleafter"`        // How long without a heartbeat before the server flags a worker as stale
+	LostAfter         time.Duration     `koanf:"lostafter"`         // How long without a heartbeat before the server marks a worker's jobs as lost
+	DrainTimeout      time.Duration     `koanf:"draintimeout"`      // How long a stopping worker waits for running jobs before returning them to the queue (0 returns them at once)
+	OutputLines       int               `koanf:"outputlines"`       // Lines of output kept per running job for the control plane
 }
 
 // DbConfig holds database-related configuration
@@ -72,8 +133,15 @@ type S3Config struct {
 
 // NXFConfig holds configuration for NXF
 type NXFConfig struct {
-	DefaultDir            string `koanf:"defaultdir"`
-	PluginsTestRepository string `koanf:"pluginstestrepository"`
+	DefaultDir            string        `koanf:"defaultdir"`
+	PluginsTestRepository string        `koanf:"pluginstestrepository"`
+	RetainFor             time.Duration `koanf:"retainfor"` // How long the work of a failed run is kept for resuming
+}
+
+// ArchiveConfig holds the limits applied when archives are extracted
+type ArchiveConfig struct {
+	MaxSize    int64 `koanf:"maxsize"`    // Largest total size, in bytes, an archive may extract to
+	MaxEntries int   `koanf:"maxentries"` // Most files and folders an archive may contain
 }
 
 // ConfigManager handles configuration loading and access
@@ -95,8 +163,18 @@ func NewConfigManager() *ConfigManager {
 				DefaultAdminPassword: "password",
 			},
 			MQ: MQConfig{
-				URL:    nats.DefaultURL,
-				MaxAge: 0, // Retain messages for 30 days
+				Backend:          MQBackendJetStream,
+				URL:              nats.DefaultURL,
+				MaxAge:           0, // Retain messages for 30 days
+				DuplicateWindow:  10 * time.Minute,
+				ConnectTimeout:   5 * time.Second,
+				MaxReconnects:    -1,
+				ReconnectWait:    2 * time.Second,
+				MaxReconnectWait: time.Minute,
+				Queue:            StreamConfig{Replicas: 1, Storage: "file", Discard: "old"},
+				Events:           StreamConfig{Replicas: 1, Storage: "file", Discard: "old"},
+				DLQ:              StreamConfig{Replicas: 1, Storage: "file", Discard: "old"},
+				Workers:          StreamConfig{Replicas: 1, Storage: "file", Discard: "old"},
 			},
 			DB: DbConfig{
 				MigrationsDir: "internal/migrations",
@@ -120,10 +198,28 @@ func NewConfigManager() *ConfigManager {
 			NXF: NXFConfig{
 				DefaultDir:            "workflows",
 				PluginsTestRepository: "https://github.com/aligndx/nf-nats/releases/download/1.0.0/nf-nats-1.0.0-meta.json",
+				RetainFor:             7 * 24 * time.Hour,
 			},
 			Logging: LoggingConfig{
 				Level: "info",
 			},
+			Worker: WorkerConfig{
+				Concurrency:       2,
+				MaxJobsPerUser:    0,
+				AckWait:           2 * time.Minute,
+				MaxAckPending:     0,
+				CPUs:              0,
+				MemoryGB:          0,
+				HeartbeatInterval: 10 * time.Second,
+				StaleAfter:        30 * time.Second,
+				LostAfter:         2 * time.Minute,
+				DrainTimeout:      10 * time.Minute,
+				OutputLines:       1000,
+			},
+			Archive: ArchiveConfig{
+				MaxSize:    50 << 30,
+				MaxEntries: 10000,
+			},
 		},
 	}
 
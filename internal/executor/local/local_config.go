@@ -1,9 +1,12 @@
 package local
 
+import "io"
+
 type LocalConfig struct {
 	Command    []string
 	Env        []string
 	WorkingDir string
+	Output     io.Writer // Receives the command's stdout and stderr; discarded when nil
 }
 
 // NewLocalConfig creates a LocalConfig with required fields and applies functional options.
@@ -39,3 +42,10 @@ func WithWorkingDir(workingDir string) LocalConfigOption {
 		config.WorkingDir = workingDir
 	}
 }
+
+// WithOutput sends the command's stdout and stderr to a writer.
+func WithOutput(output io.Writer) LocalConfigOption {
+	return func(config *LocalConfig) {
+		config.Output = output
+	}
+}
@@ -7,11 +7,15 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/aligndx/aligndx/internal/executor"
 	"github.com/aligndx/aligndx/internal/logger"
 )
 
+// terminationGracePeriod is how long a cancelled command may take to exit before it is killed.
+const terminationGracePeriod = 30 * time.Second
+
 type LocalExecutor struct {
 	log *logger.LoggerWrapper
 }
@@ -44,6 +48,7 @@ func (le *LocalExecutor) Execute(ctx context.Context, config interface{}) (strin
 
 	// Prepare the command
 	cmd := exec.CommandContext(ctx, localConfig.Command[0], localConfig.Command[1:]...)
+	configureTeardown(cmd)
 
 	// Set environment variables if provided
 	if len(localConfig.Env) > 0 {
@@ -55,9 +60,13 @@ func (le *LocalExecutor) Execute(ctx context.Context, config interface{}) (strin
 		cmd.Dir = localConfig.WorkingDir
 	}
 
-	// Suppress the logs by setting stdout and stderr to io.Discard
-	cmd.Stdout = io.Discard
-	cmd.Stderr = io.Discard
+	// Send the logs to the configured output, or suppress them by setting stdout and stderr to io.Discard
+	output := localConfig.Output
+	if output == nil {
+		output = io.Discard
+	}
+	cmd.Stdout = output
+	cmd.Stderr = output
 
 	// Execute the command
 	if err := cmd.Run(); err != nil {
@@ -89,6 +98,7 @@ func (le *LocalExecutor) ExecuteWithLogs(ctx context.Context, config interface{}
 
 	// Prepare the command.
 	cmd := exec.CommandContext(ctx, localConfig.Command[0], localConfig.Command[1:]...)
+	configureTeardown(cmd)
 	if len(localConfig.Env) > 0 {
 		cmd.Env = append(os.Environ(), localConfig.Env...)
 	}
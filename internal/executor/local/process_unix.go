@@ -0,0 +1,18 @@
+//go:build !windows
+
+package local
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// configureTeardown runs the command in its own process group and, when the context is
+// cancelled, sends SIGTERM to the whole group so child processes are stopped as well.
+func configureTeardown(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = terminationGracePeriod
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package local
+
+import (
+	"os/exec"
+)
+
+// configureTeardown kills the command when the context is cancelled.
+// Windows has no process groups to signal, so only the process itself is stopped.
+func configureTeardown(cmd *exec.Cmd) {
+	cmd.WaitDelay = terminationGracePeriod
+}
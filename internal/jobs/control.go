@@ -0,0 +1,184 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aligndx/aligndx/internal/jobs/mq"
+	"github.com/aligndx/aligndx/internal/logger"
+)
+
+// controlTimeout is how long the API waits for a worker to answer a control request.
+const controlTimeout = 5 * time.Second
+
+// defaultOutputLines is how many lines an output request returns when it does not ask for a number.
+const defaultOutputLines = 100
+
+// ControlCommand is a request the API sends to a running worker.
+type ControlCommand string
+
+const (
+	ControlListJobs    ControlCommand = "jobs"      // List the jobs the worker is running
+	ControlJobOutput   ControlCommand = "output"    // Return the last lines of a running job's output
+	ControlSetLogLevel ControlCommand = "log_level" // Change the worker's log level
+	ControlPause       ControlCommand = "pause"     // Stop pulling jobs; running jobs carry on
+	ControlResume      ControlCommand = "resume"    // Start pulling jobs again
+)
+
+// ControlRequest is a control command with its arguments.
+type ControlRequest struct {
+	Command ControlCommand `json:"command"`
+	JobID   string         `json:"jobid,omitempty"` // Job whose output ControlJobOutput returns
+	Lines   int            `json:"lines,omitempty"` // Number of lines ControlJobOutput returns
+	Level   string         `json:"level,omitempty"` // Level ControlSetLogLevel sets
+}
+
+// ControlResponse is a worker's answer to a control request. Every answer reports the worker's current state.
+type ControlResponse struct {
+	Worker   string   `json:"worker"`
+	Paused   bool     `json:"paused"`
+	LogLevel string   `json:"log_level"`
+	Jobs     []string `json:"jobs,omitempty"`
+	Lines    []string `json:"lines,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// ErrWorkerUnreachable is returned when no worker answers a control request.
+var ErrWorkerUnreachable = errors.New("worker unreachable")
+
+// ErrControlRejected is returned when a worker answers a control request with an error.
+var ErrControlRejected = errors.New("control request rejected")
+
+// controlSubject returns the subject a worker answers control requests on. It is outside every stream,
+// so requests are not stored.
+func (s *JobService) controlSubject(workerID string) string {
+	return fmt.Sprintf("%s.control.%s", s.subjectPrefix, workerID)
+}
+
+// Pause stops the worker from pulling jobs. Jobs it pulled but has not started are returned to the queue,
+// and running jobs carry on.
+func (s *JobService) Pause() {
+	if !s.paused.Swap(true) {
+		s.log.Info("Worker paused", map[string]interface{}{"worker_id": s.workerID})
+	}
+}
+
+// Resume lets a paused worker pull jobs again.
+func (s *JobService) Resume() {
+	if s.paused.Swap(false) {
+		s.log.Info("Worker resumed", map[string]interface{}{"worker_id": s.workerID})
+	}
+}
+
+// Paused reports whether the worker is paused.
+func (s *JobService) Paused() bool {
+	return s.paused.Load()
+}
+
+// ServeControl answers control requests addressed to this worker until the context is done.
+func (s *JobService) ServeControl(ctx context.Context) error {
+	if s.workerID == "" {
+		return errors.New("worker ID is required to serve control requests")
+	}
+	return s.workerMQ.Respond(ctx, s.controlSubject(s.workerID), func(data []byte) []byte {
+		var req ControlRequest
+		var resp ControlResponse
+		if err := json.Unmarshal(data, &req); err != nil {
+			resp = s.controlState()
+			resp.Error = fmt.Sprintf("invalid control request: %v", err)
+		} else {
+			resp = s.control(req)
+		}
+		reply, err := json.Marshal(resp)
+		if err != nil {
+			s.log.Error("Failed to marshal control response", map[string]interface{}{"error": err.Error()})
+		}
+		return reply
+	})
+}
+
+// control carries out a control request.
+func (s *JobService) control(req ControlRequest) ControlResponse {
+	var jobs, lines []string
+	var err error
+	switch req.Command {
+	case ControlListJobs:
+		jobs = s.RunningJobs()
+	case ControlJobOutput:
+		lines, err = s.jobOutput(req.JobID, req.Lines)
+	case ControlSetLogLevel:
+		level, ok := logger.LookupLevel(req.Level)
+		if !ok {
+			err = fmt.Errorf("unknown log level: %q", req.Level)
+			break
+		}
+		logger.SetLevel(level)
+		s.log.Info("Log level changed", map[string]interface{}{"worker_id": s.workerID, "level": level.String()})
+	case ControlPause:
+		s.Pause()
+	case ControlResume:
+		s.Resume()
+	default:
+		err = fmt.Errorf("unknown control command: %q", req.Command)
+	}
+
+	resp := s.controlState()
+	resp.Jobs, resp.Lines = jobs, lines
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp
+}
+
+// controlState returns the worker state reported with every control response.
+func (s *JobService) controlState() ControlResponse {
+	return ControlResponse{
+		Worker:   s.workerID,
+		Paused:   s.Paused(),
+		LogLevel: s.log.Level().String(),
+	}
+}
+
+// jobOutput returns the last lines of a running job's output.
+func (s *JobService) jobOutput(id string, lines int) ([]string, error) {
+	s.mu.Lock()
+	job, ok := s.running[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("job %s is not running on this worker", id)
+	}
+	if lines <= 0 {
+		lines = defaultOutputLines
+	}
+	return job.output.Tail(lines), nil
+}
+
+// Control sends a control request to a worker and returns its answer.
+func (s *JobService) Control(ctx context.Context, workerID string, req ControlRequest) (*ControlResponse, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal control request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, controlTimeout)
+	defer cancel()
+	reply, err := s.workerMQ.Request(ctx, s.controlSubject(workerID), data)
+	if err != nil {
+		if errors.Is(err, mq.ErrNoResponders) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w (worker_id: %s): %v", ErrWorkerUnreachable, workerID, err)
+		}
+		return nil, err
+	}
+
+	var resp ControlResponse
+	if err := json.Unmarshal(reply, &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal control response: %w", err)
+	}
+	if resp.Error != "" {
+		return &resp, fmt.Errorf("%w: %s", ErrControlRejected, resp.Error)
+	}
+	return &resp, nil
+}
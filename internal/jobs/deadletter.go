@@ -0,0 +1,131 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aligndx/aligndx/internal/jobs/mq"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ErrDeadLetterNotFound is returned when a job has no entry in the dead-letter stream.
+var ErrDeadLetterNotFound = errors.New("dead-lettered job not found")
+
+// DeadLetter is a job that used up its attempts, as stored in the dead-letter stream.
+type DeadLetter struct {
+	Job      Job    `json:"job"`
+	Error    string `json:"error"`
+	Attempts int    `json:"attempts"`
+	FailedAt string `json:"failed_at"`
+	Sequence uint64 `json:"sequence,omitempty"`
+}
+
+// deadLetterSubject returns the dead-letter subject for a job.
+func (s *JobService) deadLetterSubject(jobID string) string {
+	return fmt.Sprintf("%s.dlq.%s", s.subjectPrefix, jobID)
+}
+
+// deadLetter moves a failed job to the dead-letter stream and removes it from the work queue.
+func (s *JobService) deadLetter(ctx context.Context, msg jetstream.Msg, job Job, jobErr error, attempts int) {
+	entry := DeadLetter{
+		Job:      job,
+		Error:    jobErr.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now().Format(time.RFC3339),
+	}
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = s.dlqMQ.Publish(ctx, s.deadLetterSubject(job.ID), data)
+	}
+	if err != nil {
+		// Keep the job in the work queue rather than lose it.
+		s.log.Error("Failed to dead-letter job", map[string]interface{}{"job_id": job.ID, "error": err.Error()})
+		if nakErr := msg.NakWithDelay(s.retryPolicy(job.Schema).MaxBackoff); nakErr != nil {
+			s.log.Error("Failed to nak message", map[string]interface{}{"error": nakErr.Error()})
+		}
+		return
+	}
+
+	s.log.Warn("Job dead-lettered", map[string]interface{}{"job_id": job.ID, "attempts": attempts})
+	if err := s.updateJobStatus(ctx, job.ID, StatusError, jobErr.Error()); err != nil {
+		s.log.Error("Failed to update job status", map[string]interface{}{"job_id": job.ID, "error": err.Error()})
+	}
+	if err := msg.Term(); err != nil {
+		s.log.Error("Failed to terminate message", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// decodeDeadLetter unmarshals a stored dead-letter message.
+func decodeDeadLetter(msg mq.StoredMessage) (DeadLetter, error) {
+	var entry DeadLetter
+	if err := json.Unmarshal(msg.Data, &entry); err != nil {
+		return entry, fmt.Errorf("error unmarshalling dead-lettered job: %w", err)
+	}
+	entry.Sequence = msg.Sequence
+	return entry, nil
+}
+
+// ListDeadLetters returns every job in the dead-letter stream, oldest first.
+func (s *JobService) ListDeadLetters(ctx context.Context) ([]DeadLetter, error) {
+	msgs, err := s.dlqMQ.LastMessages(ctx, s.deadLetterSubject("*"))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]DeadLetter, 0, len(msgs))
+	for _, msg := range msgs {
+		entry, err := decodeDeadLetter(msg)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// GetDeadLetter returns the dead-lettered entry for a job.
+func (s *JobService) GetDeadLetter(ctx context.Context, id string) (*DeadLetter, error) {
+	msg, err := s.dlqMQ.LastMessage(ctx, s.deadLetterSubject(id))
+	if err != nil {
+		if errors.Is(err, mq.ErrMessageNotFound) {
+			return nil, ErrDeadLetterNotFound
+		}
+		return nil, err
+	}
+	entry, err := decodeDeadLetter(*msg)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// RequeueDeadLetter puts a dead-lettered job back on the work queue with a fresh set of attempts.
+// The job is validated again, so it must still be valid for the job type registered here.
+func (s *JobService) RequeueDeadLetter(ctx context.Context, id string) error {
+	entry, err := s.GetDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+	// Requeue under the current version of the job type, provided the inputs still fit it.
+	job := entry.Job
+	raw, err := s.encodeInputs(job.Schema, job.Inputs)
+	if err != nil {
+		return err
+	}
+	job.Inputs = raw
+	job.Version = s.handlers[job.Schema].jobType.Version
+
+	// The original ID may still be inside the duplicate window, so the requeue gets its own.
+	msgID := fmt.Sprintf("%s-requeue-%d", job.ID, entry.Sequence)
+	if err := s.enqueue(ctx, job, msgID); err != nil {
+		return err
+	}
+	if err := s.dlqMQ.DeleteMessage(ctx, entry.Sequence); err != nil {
+		return fmt.Errorf("error removing requeued job from dead-letter stream: %w", err)
+	}
+
+	s.log.Info("Dead-lettered job requeued", map[string]interface{}{"job_id": id})
+	return nil
+}
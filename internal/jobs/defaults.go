@@ -0,0 +1,30 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/aligndx/aligndx/internal/jobs/handlers/archive"
+	"github.com/aligndx/aligndx/internal/jobs/handlers/workflow"
+)
+
+// RegisterDefaultJobs registers the built-in job types. The API registers them to validate
+// and version jobs as they are queued, and workers register them to run those jobs.
+func RegisterDefaultJobs(s JobServiceInterface) {
+	s.RegisterJobType(Define(Definition[workflow.WorkflowInputs]{
+		Schema:   "workflow",
+		Version:  workflow.InputsVersion,
+		Validate: workflow.Validate,
+		Handle:   workflow.WorkflowHandler,
+	}), WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Minute,
+		MaxBackoff:     15 * time.Minute,
+		Multiplier:     2,
+	}))
+	s.RegisterJobType(Define(Definition[archive.ArchiveInputs]{
+		Schema:   "archive",
+		Version:  archive.InputsVersion,
+		Validate: archive.Validate,
+		Handle:   archive.ArchiveHandler,
+	}))
+}
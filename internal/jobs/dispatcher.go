@@ -0,0 +1,404 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aligndx/aligndx/internal/config"
+	"github.com/aligndx/aligndx/internal/jobs/mq"
+	"github.com/aligndx/aligndx/internal/resources"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// jobPollInterval is how long a worker waits before polling empty lanes again.
+const jobPollInterval = time.Second
+
+// deferredRetryDelay is how long a job held back by its user's running-job cap, or by a lack of
+// free resources, stays queued before it is offered again.
+const deferredRetryDelay = 30 * time.Second
+
+// pendingJob is a job pulled from the work queue that is waiting for, or running in, a worker slot.
+type pendingJob struct {
+	msg           jetstream.Msg
+	job           Job
+	lane          Priority
+	reservation   resources.Resources
+	stopHeartbeat func()
+}
+
+// dispatcher decides which pulled job runs next. Lanes are served by priority, users within a
+// lane take turns in round-robin order, and users at their running-job cap or jobs that do not
+// fit in the worker's free resources are skipped. The cap counts the jobs a user runs on every
+// worker, as last reported in the other workers' heartbeats.
+type dispatcher struct {
+	s            *JobService
+	limits       mq.ConsumerLimits
+	lookahead    int
+	maxPerUser   int
+	capacity     resources.Resources
+	defaultShare resources.Resources
+	lanes        *laneScheduler
+	pending      map[Priority][]*pendingJob
+
+	mu        sync.Mutex
+	running   map[string]int
+	elsewhere map[string]int // Jobs running on other workers for each user
+	countedAt time.Time      // When elsewhere was last loaded
+	reserved  resources.Resources
+	lastStart map[string]uint64
+	starts    uint64
+}
+
+// workerCapacity returns the resources a worker may reserve for jobs. Configured values
+// take precedence; anything left unset is detected from the machine.
+func workerCapacity(cfg config.WorkerConfig) (resources.Resources, error) {
+	capacity := resources.Resources{CPUs: cfg.CPUs, MemoryGB: cfg.MemoryGB}
+	if capacity.CPUs > 0 && capacity.MemoryGB > 0 {
+		return capacity, nil
+	}
+
+	system, err := resources.System()
+	if err != nil {
+		return resources.Resources{}, err
+	}
+	if capacity.CPUs <= 0 {
+		capacity.CPUs = system.CPUs
+	}
+	if capacity.MemoryGB <= 0 {
+		capacity.MemoryGB = system.MemoryGB
+	}
+	return capacity, nil
+}
+
+func newDispatcher(s *JobService, maxConcurrency int) (*dispatcher, error) {
+	capacity, err := workerCapacity(s.cfg.Worker)
+	if err != nil {
+		return nil, fmt.Errorf("error detecting worker resources: %w", err)
+	}
+
+	// Every worker shares the lane consumers, so MaxAckPending bounds the whole fleet. A worker
+	// limits itself through its slots and lookahead only.
+	limits := mq.ConsumerLimits{
+		AckWait:       s.cfg.Worker.AckWait,
+		MaxAckPending: s.cfg.Worker.MaxAckPending,
+	}
+
+	// Jobs that declare nothing get an even share of the worker, as if every slot were busy.
+	defaultShare := resources.Resources{
+		CPUs:     max(capacity.CPUs/maxConcurrency, 1),
+		MemoryGB: max(capacity.MemoryGB/maxConcurrency, 1),
+	}
+
+	return &dispatcher{
+		s:            s,
+		limits:       limits,
+		lookahead:    maxConcurrency,
+		maxPerUser:   s.cfg.Worker.MaxJobsPerUser,
+		capacity:     capacity,
+		defaultShare: defaultShare,
+		lanes:        newLaneScheduler(),
+		pending:      make(map[Priority][]*pendingJob),
+		running:      make(map[string]int),
+		elsewhere:    make(map[string]int),
+		lastStart:    make(map[string]uint64),
+	}, nil
+}
+
+// Process pulls job requests and processes them concurrently up to maxConcurrency.
+// Higher priority lanes are drained first, users share slots fairly and a job only starts
+// once its resources fit; each job is acknowledged only after its handler finishes.
+// Pulling stops once ctx is done, but running jobs are left to finish; see Drain.
+func (s *JobService) Process(ctx context.Context, maxConcurrency int) error {
+	// Running jobs outlive ctx and are only cancelled by Drain.
+	jobsCtx, abort := context.WithCancelCause(context.WithoutCancel(ctx))
+
+	// Listen for cancellations before pulling jobs, replaying the latest one of each job so queued jobs can be skipped.
+	if err := s.ReplaySubscribe(jobsCtx, "cancel.*", s.handleCancel, mq.DeliverLastPerSubject()); err != nil {
+		abort(err)
+		return fmt.Errorf("error subscribing to cancellations: %w", err)
+	}
+	go func() {
+		ticker := time.NewTicker(cancelPruneInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.pruneCancelled(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if err := s.requeueLegacyJobs(ctx); err != nil {
+		s.log.Error("Failed to move legacy jobs to the normal lane", map[string]interface{}{"error": err.Error()})
+	}
+
+	d, err := newDispatcher(s, maxConcurrency)
+	if err != nil {
+		abort(err)
+		return err
+	}
+	s.log.Info("Worker resources", map[string]interface{}{"cpus": d.capacity.CPUs, "memory_gb": d.capacity.MemoryGB})
+
+	dispatching := make(chan struct{})
+	s.mu.Lock()
+	s.dispatching, s.abortJobs = dispatching, abort
+	s.mu.Unlock()
+
+	semaphore := make(chan struct{}, maxConcurrency)
+	go func() {
+		defer close(dispatching)
+		defer d.release()
+		for {
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			p, ok := d.next(ctx)
+			if !ok {
+				<-semaphore
+				return
+			}
+			s.inflight.Add(1)
+			go func() {
+				defer s.inflight.Done()
+				defer func() { <-semaphore }()
+				s.handleJobMessage(jobsCtx, p)
+				d.finished(p)
+			}()
+		}
+	}()
+	return nil
+}
+
+// next waits until a pulled job can be started. It returns false once the context is done.
+// While the worker is paused, pulled jobs are returned to the queue and nothing is pulled.
+func (d *dispatcher) next(ctx context.Context) (*pendingJob, bool) {
+	for {
+		if d.s.Paused() {
+			d.release()
+		} else {
+			d.fill(ctx)
+			d.countElsewhere(ctx)
+			if p := d.pick(); p != nil {
+				return p, true
+			}
+			d.deferBlocked(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+// pendingCount returns the number of pulled jobs waiting for a slot.
+func (d *dispatcher) pendingCount() int {
+	n := 0
+	for _, jobs := range d.pending {
+		n += len(jobs)
+	}
+	return n
+}
+
+// fill pulls jobs from the lanes until the lookahead is full or the lanes are empty.
+func (d *dispatcher) fill(ctx context.Context) {
+	for _, lane := range d.lanes.order() {
+		missing := d.lookahead - d.pendingCount()
+		if missing <= 0 {
+			return
+		}
+
+		consumerName := fmt.Sprintf("request-worker-%s", lane)
+		msgs, err := d.s.workQueueMQ.Fetch(ctx, d.s.laneSubject(lane), consumerName, d.limits, missing)
+		if err != nil {
+			d.s.log.Error("Failed to fetch jobs", map[string]interface{}{"priority": string(lane), "error": err.Error()})
+			continue
+		}
+
+		for _, msg := range msgs {
+			var job Job
+			if err := json.Unmarshal(msg.Data(), &job); err != nil {
+				d.s.log.Error("Discarding malformed job", map[string]interface{}{"error": err.Error()})
+				if termErr := msg.Term(); termErr != nil {
+					d.s.log.Error("Failed to terminate message", map[string]interface{}{"error": termErr.Error()})
+				}
+				continue
+			}
+
+			d.pending[lane] = append(d.pending[lane], &pendingJob{
+				msg:           msg,
+				job:           job,
+				lane:          lane,
+				reservation:   d.reservationFor(job),
+				stopHeartbeat: d.s.heartbeat(msg),
+			})
+		}
+	}
+}
+
+// hasCapacity reports whether a user may start another job. Jobs without a user are never capped.
+func (d *dispatcher) hasCapacity(userID string) bool {
+	return userID == "" || d.maxPerUser <= 0 || d.userJobs(userID) < d.maxPerUser
+}
+
+// userJobs returns how many jobs a user runs on this worker and the others.
+func (d *dispatcher) userJobs(userID string) int {
+	return d.running[userID] + d.elsewhere[userID]
+}
+
+// countElsewhere loads the jobs each user runs on other workers from their latest heartbeats,
+// at most once per poll interval. Jobs started since a worker's last heartbeat are not seen,
+// so workers starting jobs for a user at the same time may briefly take it past its cap.
+func (d *dispatcher) countElsewhere(ctx context.Context) {
+	if d.maxPerUser <= 0 || time.Since(d.countedAt) < jobPollInterval {
+		return
+	}
+	msgs, err := d.s.workerMQ.LastMessages(ctx, d.s.workerSubject("*"))
+	if err != nil {
+		d.s.log.Error("Failed to load worker heartbeats", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	elsewhere := make(map[string]int)
+	for _, msg := range msgs {
+		var info WorkerInfo
+		if err := json.Unmarshal(msg.Data, &info); err != nil {
+			continue
+		}
+		// Stopped workers returned their jobs, and the jobs of lost ones are redelivered.
+		lostAfter := d.s.cfg.Worker.LostAfter
+		if info.ID == d.s.workerID || info.State == WorkerStopped || (lostAfter > 0 && time.Since(info.LastSeen) > lostAfter) {
+			continue
+		}
+		for userID, n := range info.RunningUsers {
+			elsewhere[userID] += n
+		}
+	}
+
+	d.mu.Lock()
+	d.elsewhere, d.countedAt = elsewhere, time.Now()
+	d.mu.Unlock()
+}
+
+// reservationFor returns the resources a job reserves while it runs. Anything the job
+// does not declare falls back to the worker's default share.
+func (d *dispatcher) reservationFor(job Job) resources.Resources {
+	r := job.Resources
+	if r.CPUs <= 0 {
+		r.CPUs = d.defaultShare.CPUs
+	}
+	if r.MemoryGB <= 0 {
+		r.MemoryGB = d.defaultShare.MemoryGB
+	}
+	return r
+}
+
+// fits reports whether a reservation fits in the worker's free resources.
+func (d *dispatcher) fits(r resources.Resources) bool {
+	return r.Fits(d.capacity.Sub(d.reserved))
+}
+
+// pick removes and returns the next job to start, or nil if no pulled job may start.
+func (d *dispatcher) pick() *pendingJob {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, lane := range d.lanes.order() {
+		jobs := d.pending[lane]
+		best := -1
+		for i, p := range jobs {
+			if !d.hasCapacity(p.job.UserID) || !d.fits(p.reservation) {
+				continue
+			}
+			// The user who started a job least recently goes first; a user's own jobs stay in order.
+			if best == -1 || d.lastStart[p.job.UserID] < d.lastStart[jobs[best].job.UserID] {
+				best = i
+			}
+		}
+		if best == -1 {
+			d.lanes.empty(lane)
+			continue
+		}
+
+		p := jobs[best]
+		d.pending[lane] = append(jobs[:best:best], jobs[best+1:]...)
+		d.lanes.served(lane)
+		d.starts++
+		d.lastStart[p.job.UserID] = d.starts
+		d.running[p.job.UserID]++
+		d.reserved = d.reserved.Add(p.reservation)
+		return p
+	}
+	return nil
+}
+
+// blockedReason explains why a pulled job cannot start yet.
+func (d *dispatcher) blockedReason(p *pendingJob) string {
+	switch {
+	case !d.hasCapacity(p.job.UserID):
+		return fmt.Sprintf("user has %d running jobs (limit %d)", d.userJobs(p.job.UserID), d.maxPerUser)
+	case !p.reservation.Fits(d.capacity):
+		return fmt.Sprintf("job needs %s, more than the worker has (%s)", p.reservation, d.capacity)
+	default:
+		return fmt.Sprintf("job needs %s, worker has %s free", p.reservation, d.capacity.Sub(d.reserved))
+	}
+}
+
+// deferBlocked returns jobs that cannot start to the queue, freeing the lookahead
+// for jobs that can and letting workers with room pick them up.
+func (d *dispatcher) deferBlocked(ctx context.Context) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for lane, jobs := range d.pending {
+		for _, p := range jobs {
+			p.stopHeartbeat()
+
+			reason := d.blockedReason(p)
+			if err := d.s.updateJobStatus(ctx, p.job.ID, StatusQueued, reason); err != nil {
+				d.s.log.Error("Failed to update job status", map[string]interface{}{"job_id": p.job.ID, "error": err.Error()})
+			}
+			if err := p.msg.NakWithDelay(deferredRetryDelay); err != nil {
+				d.s.log.Error("Failed to nak message", map[string]interface{}{"error": err.Error()})
+			}
+		}
+		delete(d.pending, lane)
+	}
+}
+
+// finished releases a job's slot and reservation.
+func (d *dispatcher) finished(p *pendingJob) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.running[p.job.UserID]--
+	if d.running[p.job.UserID] <= 0 {
+		delete(d.running, p.job.UserID)
+	}
+	d.reserved = d.reserved.Sub(p.reservation)
+}
+
+// release returns every pulled job that has not started to the queue.
+func (d *dispatcher) release() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for lane, jobs := range d.pending {
+		for _, p := range jobs {
+			p.stopHeartbeat()
+			if err := p.msg.Nak(); err != nil {
+				d.s.log.Error("Failed to nak message", map[string]interface{}{"error": err.Error()})
+			}
+		}
+		delete(d.pending, lane)
+	}
+}
@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrWorkerStopping is the cause attached to the context of jobs that were still running
+// when a worker's drain deadline passed.
+var ErrWorkerStopping = errors.New("worker stopping")
+
+// requeueStatusTimeout bounds publishing the status of a job handed back by a stopping worker.
+const requeueStatusTimeout = 5 * time.Second
+
+// Drain waits for the jobs this service is running to finish. Once the context passed to
+// Process is done no new jobs are pulled, but running jobs carry on until they finish or
+// ctx is done. Jobs still running then are cancelled and returned to the queue for
+// another worker to pick up.
+func (s *JobService) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	dispatching, abort := s.dispatching, s.abortJobs
+	s.mu.Unlock()
+	if dispatching == nil {
+		return nil
+	}
+
+	// No job starts once the dispatcher has stopped, so in-flight jobs can be waited on.
+	<-dispatching
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	running := s.RunningJobs()
+	s.log.Warn("Drain deadline passed, returning running jobs to the queue", map[string]interface{}{"jobs": running})
+	abort(ErrWorkerStopping)
+	<-done
+	return fmt.Errorf("%w: %d jobs were returned to the queue", ErrWorkerStopping, len(running))
+}
+
+// requeue hands a job interrupted by a stopping worker back to the queue.
+func (s *JobService) requeue(ctx context.Context, p *pendingJob) {
+	s.log.Info("Returning job to the queue", map[string]interface{}{"job_id": p.job.ID})
+	statusCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), requeueStatusTimeout)
+	defer cancel()
+	if err := s.updateJobStatus(statusCtx, p.job.ID, StatusQueued, "returned to the queue by a stopping worker"); err != nil {
+		s.log.Error("Failed to update job status", map[string]interface{}{"job_id": p.job.ID, "error": err.Error()})
+	}
+	if err := p.msg.Nak(); err != nil {
+		s.log.Error("Failed to nak message", map[string]interface{}{"error": err.Error()})
+	}
+}
@@ -0,0 +1,82 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aligndx/aligndx/internal/config"
+	"github.com/aligndx/aligndx/internal/logger"
+	"github.com/aligndx/aligndx/internal/nextflow"
+	pb "github.com/aligndx/aligndx/internal/pb/client"
+)
+
+// ArchiveHandler extracts an uploaded archive and recreates its contents as folder and
+// file data records, in a folder named after the archive next to it. If ingestion fails,
+// the folder and anything created under it are removed again.
+func ArchiveHandler(ctx context.Context, inputs ArchiveInputs) error {
+	log := logger.NewLoggerWrapper("zerolog", ctx)
+	configManager := config.NewConfigManager()
+	cfg := configManager.GetConfig()
+	client := pb.NewClient(cfg.API.URL, "")
+	client.SetAuthCredentials("users", cfg.API.DefaultAdminEmail, cfg.API.DefaultAdminPassword)
+
+	_, err := client.AuthWithPassword("users", cfg.API.DefaultAdminEmail, cfg.API.DefaultAdminPassword)
+	if err != nil {
+		return fmt.Errorf("failed to authenticate: %w", err)
+	}
+
+	record, err := client.ViewRecord("data", inputs.DataID, nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch archive record %s: %w", inputs.DataID, err)
+	}
+	fileName, _ := record["file"].(string)
+	if fileName == "" {
+		return fmt.Errorf("archive record %s has no file", inputs.DataID)
+	}
+	name, _ := record["name"].(string)
+	if name == "" {
+		name = fileName
+	}
+	parentID, _ := record["parent"].(string)
+
+	workDir, err := os.MkdirTemp("", "aligndx_archive_*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	log.Debug("Downloading archive", map[string]interface{}{"data_id": inputs.DataID})
+	archivePath := filepath.Join(workDir, "archive")
+	if err := client.DownloadFile("data", inputs.DataID, fileName, archivePath, map[string]string{"token": "true"}); err != nil {
+		return fmt.Errorf("failed to download archive %s: %w", fileName, err)
+	}
+
+	log.Debug("Extracting archive", map[string]interface{}{"data_id": inputs.DataID})
+	extractDir := filepath.Join(workDir, "extracted")
+	if err := Extract(ctx, archivePath, extractDir, cfg.Archive); err != nil {
+		return fmt.Errorf("failed to extract archive %s: %w", name, err)
+	}
+
+	root, err := client.CreateRecord("data", map[string]any{
+		"name":   folderName(name),
+		"type":   "folder",
+		"user":   inputs.UserID,
+		"parent": parentID,
+	}, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create folder record for %s: %w", name, err)
+	}
+	rootID, _ := root["id"].(string)
+
+	log.Debug("Storing archive contents", map[string]interface{}{"data_id": inputs.DataID})
+	if _, err := nextflow.TraverseResultsDirectory(client, inputs.UserID, "", extractDir, rootID); err != nil {
+		// Folders cascade to their contents, so this removes the partial tree.
+		if delErr := client.DeleteRecord("data", rootID); delErr != nil {
+			log.Error("Failed to remove partially stored archive", map[string]interface{}{"error": delErr.Error()})
+		}
+		return fmt.Errorf("failed to store archive contents: %w", err)
+	}
+	return nil
+}
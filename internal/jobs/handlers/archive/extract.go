@@ -0,0 +1,206 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aligndx/aligndx/internal/config"
+)
+
+var (
+	// ErrUnsupportedFormat is returned for files that are not zip, tar or gzipped tar archives.
+	ErrUnsupportedFormat = errors.New("unsupported archive format")
+	// ErrTooLarge is returned when an archive extracts to more than the configured limits.
+	ErrTooLarge = errors.New("archive exceeds extraction limits")
+	// ErrUnsafePath is returned for entries that would be written outside the extraction directory.
+	ErrUnsafePath = errors.New("archive entry escapes the extraction directory")
+)
+
+// archiveSuffixes are stripped from an archive's name to name the folder it extracts to.
+var archiveSuffixes = []string{".tar.gz", ".tgz", ".tar", ".zip"}
+
+// folderName returns the name of the folder an archive extracts to.
+func folderName(name string) string {
+	lower := strings.ToLower(name)
+	for _, suffix := range archiveSuffixes {
+		if strings.HasSuffix(lower, suffix) && len(name) > len(suffix) {
+			return name[:len(name)-len(suffix)]
+		}
+	}
+	return name
+}
+
+// extractor writes archive entries below dest while enforcing the extraction limits.
+type extractor struct {
+	ctx     context.Context
+	dest    string
+	limits  config.ArchiveConfig
+	size    int64
+	entries int
+}
+
+// Extract extracts a zip, tar or gzipped tar archive into dest. The format is detected
+// from the file's content. Links and special files are skipped.
+func Extract(ctx context.Context, archivePath, dest string, limits config.ArchiveConfig) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	x := &extractor{ctx: ctx, dest: dest, limits: limits}
+
+	reader := bufio.NewReader(file)
+	header, _ := reader.Peek(512)
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		return x.zip(file, info.Size())
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+		}
+		defer gz.Close()
+		return x.tar(gz)
+	case len(header) >= 262 && string(header[257:262]) == "ustar":
+		return x.tar(reader)
+	}
+	return ErrUnsupportedFormat
+}
+
+func (x *extractor) zip(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	for _, f := range zr.File {
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = x.dir(f.Name)
+		case mode.IsRegular():
+			err = x.zipFile(f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *extractor) zipFile(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return x.file(f.Name, rc)
+}
+
+func (x *extractor) tar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = x.dir(header.Name)
+		case tar.TypeReg:
+			err = x.file(header.Name, tr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// path returns where an entry is written, rejecting entries that would land outside dest.
+func (x *extractor) path(name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" ||
+		clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	return filepath.Join(x.dest, clean), nil
+}
+
+// count records an entry, failing once the archive has too many or the job was cancelled.
+func (x *extractor) count() error {
+	if err := x.ctx.Err(); err != nil {
+		return context.Cause(x.ctx)
+	}
+	x.entries++
+	if x.limits.MaxEntries > 0 && x.entries > x.limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrTooLarge, x.limits.MaxEntries)
+	}
+	return nil
+}
+
+func (x *extractor) dir(name string) error {
+	if err := x.count(); err != nil {
+		return err
+	}
+	target, err := x.path(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(target, 0755)
+}
+
+// file writes an entry, counting the bytes actually written rather than trusting the
+// sizes recorded in the archive.
+func (x *extractor) file(name string, r io.Reader) error {
+	if err := x.count(); err != nil {
+		return err
+	}
+	target, err := x.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if x.limits.MaxSize <= 0 {
+		n, err := io.Copy(out, r)
+		x.size += n
+		return err
+	}
+	remaining := x.limits.MaxSize - x.size
+	n, err := io.CopyN(out, r, remaining+1)
+	x.size += n
+	if n > remaining {
+		return fmt.Errorf("%w: more than %d bytes", ErrTooLarge, x.limits.MaxSize)
+	}
+	if err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
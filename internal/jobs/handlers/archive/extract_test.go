@@ -0,0 +1,247 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aligndx/aligndx/internal/config"
+)
+
+// entry is a member of a test archive. A link target makes it a symbolic link.
+type entry struct {
+	name, body, link string
+	dir              bool
+}
+
+func writeZip(t *testing.T, path string, entries []entry) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Store}
+		body := e.body
+		switch {
+		case e.dir:
+			header.SetMode(os.ModeDir | 0755)
+		case e.link != "":
+			header.SetMode(os.ModeSymlink | 0777)
+			body = e.link
+		default:
+			header.SetMode(0644)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTar(t *testing.T, path string, entries []entry, compress bool) {
+	t.Helper()
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	tw := tar.NewWriter(&buf)
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gz)
+	}
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: tar.TypeReg, Format: tar.FormatUSTAR}
+		switch {
+		case e.dir:
+			header.Typeflag, header.Mode, header.Size = tar.TypeDir, 0755, 0
+		case e.link != "":
+			header.Typeflag, header.Linkname, header.Size = tar.TypeSymlink, e.link, 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []entry
+		limits  config.ArchiveConfig
+		wantErr error
+		want    []string // Files expected in the extraction directory, with their content
+	}{
+		{
+			name: "nested files",
+			entries: []entry{
+				{name: "reads/", dir: true},
+				{name: "reads/a.fastq", body: "a"},
+				{name: "b.fastq", body: "bb"},
+			},
+			want: []string{"reads/a.fastq=a", "b.fastq=bb"},
+		},
+		{
+			name:    "parent directory entry",
+			entries: []entry{{name: "../escape.txt", body: "x"}},
+			wantErr: ErrUnsafePath,
+		},
+		{
+			name:    "nested parent directory entry",
+			entries: []entry{{name: "reads/../../escape.txt", body: "x"}},
+			wantErr: ErrUnsafePath,
+		},
+		{
+			name:    "absolute path",
+			entries: []entry{{name: "/tmp/escape.txt", body: "x"}},
+			wantErr: ErrUnsafePath,
+		},
+		{
+			name: "symlinks skipped",
+			entries: []entry{
+				{name: "outside", link: "/tmp"},
+				{name: "passwd", link: "/etc/passwd"},
+				{name: "kept.txt", body: "k"},
+			},
+			want: []string{"kept.txt=k"},
+		},
+		{
+			name:    "entry over the size limit",
+			entries: []entry{{name: "big.bin", body: strings.Repeat("x", 11)}},
+			limits:  config.ArchiveConfig{MaxSize: 10},
+			wantErr: ErrTooLarge,
+		},
+		{
+			name: "entries together over the size limit",
+			entries: []entry{
+				{name: "a.bin", body: strings.Repeat("x", 6)},
+				{name: "b.bin", body: strings.Repeat("x", 6)},
+			},
+			limits:  config.ArchiveConfig{MaxSize: 10},
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:    "entries at the size limit",
+			entries: []entry{{name: "a.bin", body: "xxxxx"}, {name: "b.bin", body: "yyyyy"}},
+			limits:  config.ArchiveConfig{MaxSize: 10},
+			want:    []string{"a.bin=xxxxx", "b.bin=yyyyy"},
+		},
+		{
+			name:    "too many entries",
+			entries: []entry{{name: "a", body: "a"}, {name: "b", body: "b"}, {name: "c", body: "c"}},
+			limits:  config.ArchiveConfig{MaxEntries: 2},
+			wantErr: ErrTooLarge,
+		},
+	}
+
+	formats := []struct {
+		name  string
+		write func(t *testing.T, path string, entries []entry)
+	}{
+		{"zip", writeZip},
+		{"tar", func(t *testing.T, path string, entries []entry) { writeTar(t, path, entries, false) }},
+		{"tar.gz", func(t *testing.T, path string, entries []entry) { writeTar(t, path, entries, true) }},
+	}
+
+	for _, format := range formats {
+		for _, tt := range tests {
+			t.Run(format.name+"/"+tt.name, func(t *testing.T) {
+				dir := t.TempDir()
+				archivePath := filepath.Join(dir, "upload."+format.name)
+				format.write(t, archivePath, tt.entries)
+				dest := filepath.Join(dir, "out", "extracted")
+
+				err := Extract(context.Background(), archivePath, dest, tt.limits)
+				if tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("Extract = %v, want %v", err, tt.wantErr)
+					}
+				} else if err != nil {
+					t.Fatalf("Extract: %v", err)
+				}
+
+				// Nothing may be written next to the extraction directory.
+				if outside, _ := filepath.Glob(filepath.Join(dir, "out", "*")); len(outside) != 1 {
+					t.Fatalf("entries written outside the extraction directory: %v", outside)
+				}
+				if _, err := os.Stat(filepath.Join(dir, "escape.txt")); err == nil {
+					t.Fatal("escape.txt written outside the extraction directory")
+				}
+
+				var got []string
+				filepath.WalkDir(dest, func(path string, d os.DirEntry, err error) error {
+					if err != nil || d.IsDir() {
+						return err
+					}
+					if d.Type()&os.ModeSymlink != 0 {
+						t.Errorf("symlink %s extracted", path)
+						return nil
+					}
+					body, _ := os.ReadFile(path)
+					rel, _ := filepath.Rel(dest, path)
+					got = append(got, filepath.ToSlash(rel)+"="+string(body))
+					return nil
+				})
+				if tt.wantErr == nil && !sameFiles(got, tt.want) {
+					t.Fatalf("extracted %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestExtractUnsupportedFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("not an archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Extract(context.Background(), path, t.TempDir(), config.ArchiveConfig{}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("Extract = %v, want ErrUnsupportedFormat", err)
+	}
+}
+
+// sameFiles reports whether two lists hold the same files in any order.
+func sameFiles(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	seen := make(map[string]int)
+	for _, f := range got {
+		seen[f]++
+	}
+	for _, f := range want {
+		if seen[f] == 0 {
+			return false
+		}
+		seen[f]--
+	}
+	return true
+}
@@ -0,0 +1,24 @@
+package archive
+
+import "fmt"
+
+// InputsVersion is the version of ArchiveInputs. Bump it whenever the inputs change in a way
+// older workers cannot handle.
+const InputsVersion = 1
+
+// ArchiveInputs identifies an uploaded archive to extract into the data collection.
+type ArchiveInputs struct {
+	DataID string `json:"dataid"` // The data record holding the archive
+	UserID string `json:"userid"` // The user the extracted data belongs to
+}
+
+// Validate checks that inputs name an archive and its owner.
+func Validate(inputs ArchiveInputs) error {
+	if inputs.DataID == "" {
+		return fmt.Errorf("dataid is required")
+	}
+	if inputs.UserID == "" {
+		return fmt.Errorf("userid is required")
+	}
+	return nil
+}
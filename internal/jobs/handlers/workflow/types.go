@@ -1,5 +1,11 @@
 package workflow
 
+import "fmt"
+
+// InputsVersion is the version of WorkflowInputs. Bump it whenever the inputs change in a way
+// older workers cannot handle.
+const InputsVersion = 1
+
 type WorkflowInputs struct {
 	Name       string                 `json:"name"`
 	Repository string                 `json:"repository"`
@@ -7,4 +13,23 @@ type WorkflowInputs struct {
 	Inputs     map[string]interface{} `json:"inputs"`
 	JobID      string                 `json:"jobid"`
 	UserID     string                 `json:"userid"`
+	Resume     bool                   `json:"resume,omitempty"` // Resume the job's previous run, reusing its completed tasks
+}
+
+// Validate checks that inputs name a repository and set every parameter the workflow schema requires.
+func Validate(inputs WorkflowInputs) error {
+	if inputs.Repository == "" {
+		return fmt.Errorf("repository is required")
+	}
+	required, _ := inputs.Schema["required"].([]interface{})
+	for _, name := range required {
+		key, ok := name.(string)
+		if !ok {
+			continue
+		}
+		if value, ok := inputs.Inputs[key]; !ok || value == nil || value == "" {
+			return fmt.Errorf("parameter %s is required", key)
+		}
+	}
+	return nil
 }
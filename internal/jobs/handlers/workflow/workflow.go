@@ -2,7 +2,6 @@ package workflow
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 
 	"github.com/aligndx/aligndx/internal/config"
@@ -11,7 +10,7 @@ import (
 	pb "github.com/aligndx/aligndx/internal/pb/client"
 )
 
-func WorkflowHandler(ctx context.Context, inputs interface{}) error {
+func WorkflowHandler(ctx context.Context, inputs WorkflowInputs) error {
 	log := logger.NewLoggerWrapper("zerolog", ctx)
 	configManager := config.NewConfigManager()
 	cfg := configManager.GetConfig()
@@ -22,14 +21,7 @@ func WorkflowHandler(ctx context.Context, inputs interface{}) error {
 	if err != nil {
 		return fmt.Errorf("failed to authenticate: %w", err)
 	}
-	var workflowInputs nextflow.NextflowInputs
-	inputBytes, err := json.Marshal(inputs) // Marshal interface to JSON first
-	if err != nil {
-		return fmt.Errorf("failed to marshal inputs: %w", err)
-	}
-	if err := json.Unmarshal(inputBytes, &workflowInputs); err != nil {
-		return fmt.Errorf("failed to unmarshal inputs to WorkflowInputs: %w", err)
-	}
+	workflowInputs := inputs.nextflowInputs()
 
 	log.Debug("Starting nextflow.Run")
 	err = nextflow.Run(ctx, client, log, cfg, workflowInputs)
@@ -41,7 +33,7 @@ func WorkflowHandler(ctx context.Context, inputs interface{}) error {
 	return nil
 }
 
-func WorkflowHandlerWithLogs(ctx context.Context, inputs interface{}) error {
+func WorkflowHandlerWithLogs(ctx context.Context, inputs WorkflowInputs) error {
 	log := logger.NewLoggerWrapper("zerolog", ctx)
 	configManager := config.NewConfigManager()
 	cfg := configManager.GetConfig()
@@ -52,14 +44,7 @@ func WorkflowHandlerWithLogs(ctx context.Context, inputs interface{}) error {
 	if err != nil {
 		return fmt.Errorf("failed to authenticate: %w", err)
 	}
-	var workflowInputs nextflow.NextflowInputs
-	inputBytes, err := json.Marshal(inputs) // Marshal interface to JSON first
-	if err != nil {
-		return fmt.Errorf("failed to marshal inputs: %w", err)
-	}
-	if err := json.Unmarshal(inputBytes, &workflowInputs); err != nil {
-		return fmt.Errorf("failed to unmarshal inputs to WorkflowInputs: %w", err)
-	}
+	workflowInputs := inputs.nextflowInputs()
 
 	log.Debug("Starting nextflow.Run")
 	logChan, err := nextflow.RunWithLogs(ctx, client, log, cfg, workflowInputs)
@@ -77,3 +62,16 @@ func WorkflowHandlerWithLogs(ctx context.Context, inputs interface{}) error {
 	log.Debug("Finished nextflow.Run")
 	return nil
 }
+
+// nextflowInputs converts the job inputs into the inputs of a Nextflow run.
+func (inputs WorkflowInputs) nextflowInputs() nextflow.NextflowInputs {
+	return nextflow.NextflowInputs{
+		Name:       inputs.Name,
+		Repository: inputs.Repository,
+		Schema:     inputs.Schema,
+		Inputs:     inputs.Inputs,
+		UserID:     inputs.UserID,
+		JobID:      inputs.JobID,
+		Resume:     inputs.Resume,
+	}
+}
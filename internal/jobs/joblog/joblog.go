@@ -0,0 +1,89 @@
+// Package joblog keeps the most recent output lines of running jobs, so they can be inspected while the job runs.
+package joblog
+
+import (
+	"bytes"
+	"context"
+	"sync"
+)
+
+// maxLineLength caps a single line; longer lines are split.
+const maxLineLength = 4096
+
+// Buffer keeps the last lines written to it in a fixed-size ring. It is safe for concurrent use.
+type Buffer struct {
+	mu      sync.Mutex
+	lines   []string
+	next    int // Index the next complete line is stored at
+	full    bool
+	partial []byte // Trailing output not yet ended by a newline
+}
+
+// NewBuffer returns a buffer that keeps up to size lines.
+func NewBuffer(size int) *Buffer {
+	return &Buffer{lines: make([]string, max(size, 1))}
+}
+
+// Write implements io.Writer, splitting the output into lines.
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data := p
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			b.partial = append(b.partial, data...)
+			for len(b.partial) >= maxLineLength {
+				b.add(b.partial[:maxLineLength])
+				b.partial = b.partial[maxLineLength:]
+			}
+			break
+		}
+		b.add(append(b.partial, data[:i]...))
+		b.partial = b.partial[:0]
+		data = data[i+1:]
+	}
+	return len(p), nil
+}
+
+// add stores a complete line, overwriting the oldest one once the ring is full.
+func (b *Buffer) add(line []byte) {
+	b.lines[b.next] = string(bytes.TrimRight(line, "\r"))
+	b.next = (b.next + 1) % len(b.lines)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Tail returns up to the last n lines, oldest first, including any unterminated trailing output.
+func (b *Buffer) Tail(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var lines []string
+	if b.full {
+		lines = append(lines, b.lines[b.next:]...)
+	}
+	lines = append(lines, b.lines[:b.next]...)
+	if len(b.partial) > 0 {
+		lines = append(lines, string(b.partial))
+	}
+	if n > 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+type bufferKey struct{}
+
+// WithBuffer returns a context carrying the buffer a job's output is written to.
+func WithBuffer(ctx context.Context, b *Buffer) context.Context {
+	return context.WithValue(ctx, bufferKey{}, b)
+}
+
+// FromContext returns the job output buffer carried by the context, or nil if there is none.
+func FromContext(ctx context.Context) *Buffer {
+	b, _ := ctx.Value(bufferKey{}).(*Buffer)
+	return b
+}
@@ -3,12 +3,17 @@ package jobs
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aligndx/aligndx/internal/config"
+	"github.com/aligndx/aligndx/internal/jobs/joblog"
 	"github.com/aligndx/aligndx/internal/jobs/mq"
 	"github.com/aligndx/aligndx/internal/logger"
+	"github.com/aligndx/aligndx/internal/resources"
 	"github.com/nats-io/nats.go/jetstream"
 )
 
@@ -17,9 +22,57 @@ type JobHandler func(ctx context.Context, inputs interface{}) error
 
 // Job represents a job that can be queued and processed.
 type Job struct {
-	ID     string      `json:"job_id"`
-	Inputs interface{} `json:"job_inputs"`
-	Schema string      `json:"job_schema"`
+	ID        string              `json:"job_id"`
+	Inputs    json.RawMessage     `json:"job_inputs"`
+	Schema    string              `json:"job_schema"`
+	Version   int                 `json:"job_version,omitempty"`
+	Priority  Priority            `json:"job_priority,omitempty"`
+	UserID    string              `json:"job_user,omitempty"`
+	Resources resources.Resources `json:"job_resources,omitempty"`
+	Timeout   time.Duration       `json:"job_timeout,omitempty"`
+	QueuedAt  time.Time           `json:"job_queued_at,omitempty"`
+
+	dedupID string
+}
+
+// QueueOption configures a job when it is queued.
+type QueueOption func(*Job)
+
+// WithPriority publishes the job to the given priority lane.
+func WithPriority(priority Priority) QueueOption {
+	return func(job *Job) {
+		job.Priority = priority
+	}
+}
+
+// WithUser records the user a job runs for, so workers can share slots fairly between users.
+func WithUser(userID string) QueueOption {
+	return func(job *Job) {
+		job.UserID = userID
+	}
+}
+
+// WithResources declares the CPUs and memory a job needs, so workers only start it when it fits.
+func WithResources(r resources.Resources) QueueOption {
+	return func(job *Job) {
+		job.Resources = r
+	}
+}
+
+// WithTimeout limits how long a job may run. A job still running at the deadline is killed
+// and reported as timed out.
+func WithTimeout(timeout time.Duration) QueueOption {
+	return func(job *Job) {
+		job.Timeout = timeout
+	}
+}
+
+// WithDeduplicationID sets the ID used to drop duplicate enqueues of a job, which defaults to
+// the job ID. Queueing a job again under its own ID, e.g. to rerun it, needs a fresh one.
+func WithDeduplicationID(id string) QueueOption {
+	return func(job *Job) {
+		job.dedupID = id
+	}
 }
 
 // Event is a generic event type.
@@ -32,27 +85,70 @@ type Event[T any] struct {
 
 // JobServiceInterface defines the methods of our job service.
 type JobServiceInterface interface {
-	Queue(ctx context.Context, id string, inputs interface{}, schema string) error
-	RegisterJobHandler(schema string, handler JobHandler)
+	Queue(ctx context.Context, id string, inputs interface{}, schema string, opts ...QueueOption) error
+	Cancel(ctx context.Context, id string) error
+	UpdateStatus(ctx context.Context, id string, status JobStatus, reason string) error
+	PublishProgress(ctx context.Context, id string, progress Progress) error
+	RegisterJobHandler(schema string, handler JobHandler, opts ...HandlerOption)
+	RegisterJobType(t JobType, opts ...HandlerOption)
+	JobTypes() map[string]int
+	Validate(schema string, inputs interface{}) error
 	Process(ctx context.Context, maxConcurrency int) error
-	Subscribe(ctx context.Context, subject string, consumerName string, handler func(jetstream.Msg)) error
-	ReplaySubscribe(ctx context.Context, subject string, handler func(jetstream.Msg)) error
+	Subscribe(ctx context.Context, subject string, consumerName string, handler func(jetstream.Msg), opts ...mq.SubscribeOption) error
+	ReplaySubscribe(ctx context.Context, subject string, handler func(jetstream.Msg), opts ...mq.SubscribeOption) error
+	ListDeadLetters(ctx context.Context) ([]DeadLetter, error)
+	GetDeadLetter(ctx context.Context, id string) (*DeadLetter, error)
+	RequeueDeadLetter(ctx context.Context, id string) error
+	RunningJobs() []string
+	RunningUsers() map[string]int
+	Drain(ctx context.Context) error
+	SetWorkerID(id string)
+	Pause()
+	Resume()
+	Paused() bool
+	ServeControl(ctx context.Context) error
+	Control(ctx context.Context, workerID string, req ControlRequest) (*ControlResponse, error)
+	MQHealth() mq.ConnectionHealth
+	PublishWorkerHeartbeat(ctx context.Context, info WorkerInfo) error
+	WatchWorkers(ctx context.Context) *WorkerRegistry
 }
 
 // MessageQueueService is used by the job service.
 type MessageQueueService interface {
-	Publish(ctx context.Context, subject string, data []byte) error
-	Subscribe(ctx context.Context, subject string, consumerName string, handler func(jetstream.Msg)) error
+	Publish(ctx context.Context, subject string, data []byte, opts ...mq.PublishOption) error
+	Subscribe(ctx context.Context, subject string, consumerName string, handler func(jetstream.Msg), opts ...mq.SubscribeOption) error
+	Fetch(ctx context.Context, subject string, consumerName string, limits mq.ConsumerLimits, batch int) ([]jetstream.Msg, error)
+	LastMessage(ctx context.Context, subject string) (*mq.StoredMessage, error)
+	LastMessages(ctx context.Context, filter string) ([]mq.StoredMessage, error)
+	DeleteMessage(ctx context.Context, seq uint64) error
+	FirstMessageTime(ctx context.Context) (time.Time, error)
+	Purge(ctx context.Context, subject string) error
+	Request(ctx context.Context, subject string, data []byte) ([]byte, error)
+	Respond(ctx context.Context, subject string, handler func(data []byte) []byte) error
 }
 
 // JobService implements JobServiceInterface and encapsulates its own MQ and config setup.
 type JobService struct {
+	conn          *mq.Connection // Nil when the message queue is kept in memory
 	workQueueMQ   MessageQueueService
 	eventMQ       MessageQueueService
+	dlqMQ         MessageQueueService
+	workerMQ      MessageQueueService
 	log           *logger.LoggerWrapper
 	cfg           *config.Config
-	handlers      map[string]JobHandler
+	handlers      map[string]registeredHandler
 	subjectPrefix string
+	workerID      string
+	paused        atomic.Bool
+
+	mu        sync.Mutex
+	running   map[string]runningJob
+	cancelled map[string]time.Time
+
+	// Set by Process, so Drain can wait for the dispatcher and in-flight jobs.
+	dispatching chan struct{}
+	inflight    sync.WaitGroup
+	abortJobs   context.CancelCauseFunc
 }
 
 // JobStatus represents the state of a job.
@@ -64,162 +160,589 @@ const (
 	StatusProcessing JobStatus = "processing"
 	StatusCompleted  JobStatus = "completed"
 	StatusError      JobStatus = "error"
+	StatusCancelled  JobStatus = "cancelled"
+	StatusRetrying   JobStatus = "retrying"
+	StatusLost       JobStatus = "lost"
+	StatusTimeout    JobStatus = "timeout"
+	StatusWaiting    JobStatus = "waiting"
 )
 
+// IsTerminal reports whether a job in this status will not run again.
+func (s JobStatus) IsTerminal() bool {
+	switch s {
+	case StatusCompleted, StatusError, StatusCancelled, StatusTimeout:
+		return true
+	}
+	return false
+}
+
+// cancelPruneInterval is how often a worker forgets cancellations that no queued job can match.
+const cancelPruneInterval = 10 * time.Minute
+
+// cancelClockSkew is how much earlier than its message a job's queued time may be.
+const cancelClockSkew = time.Minute
+
+// ErrJobCancelled is the cause attached to a job's context when the job is cancelled.
+var ErrJobCancelled = errors.New("job cancelled")
+
+// ErrJobTimeout is the cause attached to a job's context when the job runs past its timeout.
+// Timed out jobs are not retried.
+var ErrJobTimeout = errors.New("job timed out")
+
+// ErrNoHandler is returned when a job's schema has no registered handler. Such jobs are not retried.
+var ErrNoHandler = errors.New("no handler registered for schema")
+
+// memoryBroker is shared by every job service in the process when the memory backend is selected,
+// so an embedded worker and the API server see the same streams.
+var memoryBroker = sync.OnceValue(mq.NewMemoryBroker)
+
+// connect opens the connection shared by the streams of a job service.
+// It returns nil when the message queue is kept in memory.
+func connect(cfg *config.Config, log *logger.LoggerWrapper) (*mq.Connection, error) {
+	switch cfg.MQ.Backend {
+	case config.MQBackendMemory:
+		return nil, nil
+	case config.MQBackendJetStream, "":
+		return mq.Connect(cfg.MQ, log)
+	}
+	return nil, fmt.Errorf("unknown message queue backend: %q", cfg.MQ.Backend)
+}
+
+// openStream creates or updates a stream on the connection, or on the in-memory broker if there is none,
+// and returns a service bound to it.
+func openStream(ctx context.Context, conn *mq.Connection, streamConfig jetstream.StreamConfig, log *logger.LoggerWrapper) (MessageQueueService, error) {
+	if conn == nil {
+		return mq.NewMemoryMessageQueueService(memoryBroker(), streamConfig, log)
+	}
+	return mq.NewJetStreamMessageQueueService(ctx, conn, streamConfig, log)
+}
+
 // NewJobService returns a new instance of JobService.
 func NewJobService(ctx context.Context, log *logger.LoggerWrapper, cfg *config.Config) (JobServiceInterface, error) {
+	conn, err := connect(cfg, log)
+	if err != nil {
+		log.Error("Failed to connect to MQ", map[string]interface{}{"error": err.Error()})
+		return nil, fmt.Errorf("failed to connect to mq: %w", err)
+	}
+
 	// Setup the work queue stream configuration using WorkQueuePolicy.
-	workQueueConfig := jetstream.StreamConfig{
+	workQueueConfig, err := mq.ConfigureStream(jetstream.StreamConfig{
 		Name:      "QUEUE",
-		Retention: jetstream.WorkQueuePolicy, // Work queue retention policy
-		Subjects:  []string{"jobs.request"},
-		Storage:   jetstream.FileStorage,
+		Retention: jetstream.WorkQueuePolicy,                  // Work queue retention policy
+		Subjects:  []string{"jobs.request.*", "jobs.request"}, // One subject per priority lane, and the subject jobs were queued on before lanes
+	}, cfg.MQ.Queue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mq configuration: %w", err)
 	}
-	workQueueMQ, err := mq.NewJetStreamMessageQueueService(ctx, cfg.MQ.URL, workQueueConfig, log)
+	workQueueConfig.Duplicates = duplicateWindow(cfg.MQ.DuplicateWindow, workQueueConfig.MaxAge) // Jobs are published with their ID, so repeats are dropped
+	workQueueMQ, err := openStream(ctx, conn, workQueueConfig, log)
 	if err != nil {
 		log.Error("Failed to initialize work queue MQ service", map[string]interface{}{"error": err.Error()})
 		return nil, fmt.Errorf("failed to initialize work queue mq: %w", err)
 	}
 
 	// Setup the event stream configuration using a replayable retention policy (LimitsPolicy).
-	eventStreamConfig := jetstream.StreamConfig{
+	eventSettings := cfg.MQ.Events
+	if eventSettings.MaxAge == 0 {
+		eventSettings.MaxAge = cfg.MQ.MaxAge
+	}
+	eventStreamConfig, err := mq.ConfigureStream(jetstream.StreamConfig{
 		Name:      "EVENTS",
 		Retention: jetstream.LimitsPolicy,    // Replayable retention for job events
 		Subjects:  []string{"jobs.events.>"}, // Catch-all for all events
-		Storage:   jetstream.FileStorage,
-		MaxAge:    cfg.MQ.MaxAge,
+	}, eventSettings)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mq configuration: %w", err)
 	}
-	eventMQ, err := mq.NewJetStreamMessageQueueService(ctx, cfg.MQ.URL, eventStreamConfig, log)
+	eventStreamConfig.Duplicates = duplicateWindow(cfg.MQ.DuplicateWindow, eventStreamConfig.MaxAge)
+	eventMQ, err := openStream(ctx, conn, eventStreamConfig, log)
 	if err != nil {
 		log.Error("Failed to initialize event MQ service", map[string]interface{}{"error": err.Error()})
 		return nil, fmt.Errorf("failed to initialize event mq: %w", err)
 	}
 
+	// Setup the dead-letter stream, keeping the latest failure of each job.
+	dlqStreamConfig, err := mq.ConfigureStream(jetstream.StreamConfig{
+		Name:              "QUEUE_DLQ",
+		Retention:         jetstream.LimitsPolicy,
+		Subjects:          []string{"jobs.dlq.*"},
+		MaxMsgsPerSubject: 1,
+	}, cfg.MQ.DLQ)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mq configuration: %w", err)
+	}
+	dlqMQ, err := openStream(ctx, conn, dlqStreamConfig, log)
+	if err != nil {
+		log.Error("Failed to initialize dead-letter MQ service", map[string]interface{}{"error": err.Error()})
+		return nil, fmt.Errorf("failed to initialize dead-letter mq: %w", err)
+	}
+
+	// Setup the worker heartbeat stream, keeping the latest heartbeat of each worker.
+	workerStreamConfig, err := mq.ConfigureStream(jetstream.StreamConfig{
+		Name:              "WORKERS",
+		Retention:         jetstream.LimitsPolicy,
+		Subjects:          []string{"jobs.workers.*"},
+		MaxMsgsPerSubject: 1,
+	}, cfg.MQ.Workers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mq configuration: %w", err)
+	}
+	workerMQ, err := openStream(ctx, conn, workerStreamConfig, log)
+	if err != nil {
+		log.Error("Failed to initialize worker MQ service", map[string]interface{}{"error": err.Error()})
+		return nil, fmt.Errorf("failed to initialize worker mq: %w", err)
+	}
+
 	return &JobService{
+		conn:          conn,
 		workQueueMQ:   workQueueMQ,
 		eventMQ:       eventMQ,
+		dlqMQ:         dlqMQ,
+		workerMQ:      workerMQ,
 		log:           log,
 		cfg:           cfg,
-		handlers:      make(map[string]JobHandler),
+		handlers:      make(map[string]registeredHandler),
 		subjectPrefix: "jobs",
+		running:       make(map[string]runningJob),
+		cancelled:     make(map[string]time.Time),
 	}, nil
 }
 
+// MQHealth reports the state of the message queue connection. A queue kept in memory is always healthy.
+func (s *JobService) MQHealth() mq.ConnectionHealth {
+	if s.conn == nil {
+		return mq.ConnectionHealth{Backend: config.MQBackendMemory, Status: "connected", Healthy: true}
+	}
+	return s.conn.Health()
+}
+
+// duplicateWindow returns the configured duplicate window, which may not exceed the stream's maximum age.
+func duplicateWindow(window, maxAge time.Duration) time.Duration {
+	if maxAge > 0 && window > maxAge {
+		return maxAge
+	}
+	return window
+}
+
 // StatusEventMetadata defines metadata for job status events.
 type StatusEventMetadata struct {
 	JobID  string    `json:"jobid"`
 	Status JobStatus `json:"status"`
+	Reason string    `json:"reason,omitempty"`
+	Worker string    `json:"worker,omitempty"` // The worker that published the status, if any
 }
 
-// updateJobStatus publishes an event to update a job’s status.
-func (s *JobService) updateJobStatus(ctx context.Context, ID string, status JobStatus) error {
+// updateJobStatus publishes an event to update a job’s status, with an optional reason.
+func (s *JobService) updateJobStatus(ctx context.Context, ID string, status JobStatus, reason string, opts ...mq.PublishOption) error {
+	message := fmt.Sprintf("Job %s updated to %s", ID, status)
+	if reason != "" {
+		message = fmt.Sprintf("%s: %s", message, reason)
+	}
 	event := Event[StatusEventMetadata]{
 		Type:      "job.status",
-		Message:   fmt.Sprintf("Job %s updated to %s", ID, status),
+		Message:   message,
 		TimeStamp: time.Now().Format(time.RFC3339),
 		MetaData: StatusEventMetadata{
 			JobID:  ID,
 			Status: status,
+			Reason: reason,
+			Worker: s.workerID,
 		},
 	}
 	data, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal event: %w", err)
 	}
-	subj := fmt.Sprintf("%s.events.status.%s", s.subjectPrefix, ID)
-	return s.eventMQ.Publish(ctx, subj, data)
+	return s.eventMQ.Publish(ctx, s.statusSubject(ID), data, opts...)
+}
+
+// statusSubject returns the status event subject of a job.
+func (s *JobService) statusSubject(jobID string) string {
+	return fmt.Sprintf("%s.events.status.%s", s.subjectPrefix, jobID)
+}
+
+// UpdateStatus publishes a status change for a job that is not running on a worker,
+// such as one waiting on another submission.
+func (s *JobService) UpdateStatus(ctx context.Context, id string, status JobStatus, reason string) error {
+	return s.updateJobStatus(ctx, id, status, reason)
+}
+
+// CancelEventMetadata defines metadata for job cancellation control messages.
+type CancelEventMetadata struct {
+	JobID       string    `json:"jobid"`
+	RequestedAt time.Time `json:"requested_at,omitempty"`
+}
+
+// Cancel publishes a cancellation control message for a job and marks it as cancelled.
+// A worker running the job cancels its context; a worker that pulls it later skips it.
+func (s *JobService) Cancel(ctx context.Context, id string) error {
+	event := Event[CancelEventMetadata]{
+		Type:      "job.cancel",
+		Message:   fmt.Sprintf("Job %s cancellation requested", id),
+		TimeStamp: time.Now().Format(time.RFC3339),
+		MetaData: CancelEventMetadata{
+			JobID:       id,
+			RequestedAt: time.Now(),
+		},
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	if err := s.eventMQ.Publish(ctx, s.cancelSubject(id), data); err != nil {
+		return fmt.Errorf("error publishing cancellation: %w", err)
+	}
+
+	s.log.Debug("Job cancellation requested", map[string]interface{}{"job_id": id})
+	return s.updateJobStatus(ctx, id, StatusCancelled, "")
+}
+
+// cancelSubject returns the cancellation subject of a job.
+func (s *JobService) cancelSubject(jobID string) string {
+	return fmt.Sprintf("%s.events.cancel.%s", s.subjectPrefix, jobID)
+}
+
+// runningJob is a job running in this service.
+type runningJob struct {
+	cancel   context.CancelCauseFunc
+	userID   string
+	queuedAt time.Time
+	output   *joblog.Buffer
+}
+
+// pruneCancelled forgets cancellations requested before the oldest job in the work queue was
+// queued, as no job still queued can match them, and purges them from the event stream so
+// workers do not replay them when they start.
+func (s *JobService) pruneCancelled(ctx context.Context) {
+	oldest, err := s.workQueueMQ.FirstMessageTime(ctx)
+	if err != nil {
+		s.log.Error("Failed to load the oldest queued job", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	horizon := time.Now()
+	if !oldest.IsZero() {
+		horizon = oldest
+	}
+	// A job's queued time is taken just before its message is stored.
+	horizon = horizon.Add(-cancelClockSkew)
+
+	var pruned []string
+	s.mu.Lock()
+	for id, requestedAt := range s.cancelled {
+		if requestedAt.Before(horizon) {
+			delete(s.cancelled, id)
+			pruned = append(pruned, id)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, id := range pruned {
+		if err := s.eventMQ.Purge(ctx, s.cancelSubject(id)); err != nil {
+			s.log.Error("Failed to purge cancellation", map[string]interface{}{"job_id": id, "error": err.Error()})
+		}
+	}
+	if len(pruned) > 0 {
+		s.log.Debug("Pruned cancellations", map[string]interface{}{"count": len(pruned)})
+	}
+}
+
+// cancels reports whether a cancellation requested at the given time applies to a job queued
+// at queuedAt. A job queued again after it was cancelled, e.g. to resume it, runs.
+func cancels(requestedAt, queuedAt time.Time) bool {
+	return !requestedAt.Before(queuedAt)
+}
+
+// handleCancel cancels a running job, or remembers the cancellation for when the job is pulled.
+func (s *JobService) handleCancel(msg jetstream.Msg) {
+	var event Event[CancelEventMetadata]
+	if err := json.Unmarshal(msg.Data(), &event); err != nil {
+		s.log.Error("Failed to unmarshal cancellation", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.running[event.MetaData.JobID]; ok {
+		if cancels(event.MetaData.RequestedAt, job.queuedAt) {
+			s.log.Info("Cancelling running job", map[string]interface{}{"job_id": event.MetaData.JobID})
+			job.cancel(ErrJobCancelled)
+		}
+		return
+	}
+	s.cancelled[event.MetaData.JobID] = event.MetaData.RequestedAt
+}
+
+// startJob registers a job as running and returns its context.
+// It returns false if the job was cancelled before it started.
+func (s *JobService) startJob(ctx context.Context, job Job) (context.Context, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if requestedAt, ok := s.cancelled[job.ID]; ok {
+		delete(s.cancelled, job.ID)
+		if cancels(requestedAt, job.QueuedAt) {
+			return nil, false
+		}
+	}
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	output := joblog.NewBuffer(s.cfg.Worker.OutputLines)
+	s.running[job.ID] = runningJob{cancel: cancel, userID: job.UserID, queuedAt: job.QueuedAt, output: output}
+	return joblog.WithBuffer(jobCtx, output), true
+}
+
+// finishJob releases the context of a running job.
+func (s *JobService) finishJob(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.running[id]; ok {
+		job.cancel(nil)
+		delete(s.running, id)
+	}
 }
 
 // Queue creates a job and publishes it to the job queue.
-func (s *JobService) Queue(ctx context.Context, id string, inputs interface{}, schema string) error {
+func (s *JobService) Queue(ctx context.Context, id string, inputs interface{}, schema string, opts ...QueueOption) error {
+	raw, err := s.encodeInputs(schema, inputs)
+	if err != nil {
+		return err
+	}
 	job := Job{
-		ID:     id,
-		Inputs: inputs,
-		Schema: schema,
+		ID:       id,
+		Inputs:   raw,
+		Schema:   schema,
+		Version:  s.handlers[schema].jobType.Version,
+		Priority: PriorityNormal,
+	}
+	for _, opt := range opts {
+		opt(&job)
 	}
+	msgID := job.ID
+	if job.dedupID != "" {
+		msgID = job.dedupID
+	}
+	return s.enqueue(ctx, job, msgID)
+}
 
+// laneSubject returns the work-queue subject of a priority lane.
+func (s *JobService) laneSubject(priority Priority) string {
+	return fmt.Sprintf("%s.request.%s", s.subjectPrefix, ParsePriority(string(priority)))
+}
+
+// enqueue marks a job as queued and publishes it to the work queue. Both messages carry IDs
+// derived from msgID, so enqueueing the same job twice within the duplicate window queues it once.
+func (s *JobService) enqueue(ctx context.Context, job Job, msgID string) error {
+	job.QueuedAt = time.Now()
 	jobData, err := json.Marshal(job)
 	if err != nil {
 		return fmt.Errorf("error marshaling job data: %w", err)
 	}
 
+	// Publish the status first so it cannot overwrite a worker's processing update.
+	if err := s.updateJobStatus(ctx, job.ID, StatusQueued, "", mq.WithMsgID(msgID+"-queued")); err != nil {
+		return err
+	}
+
 	// Publish the job to the work queue.
-	if err := s.workQueueMQ.Publish(ctx, fmt.Sprintf("%s.request", s.subjectPrefix), jobData); err != nil {
+	if err := s.workQueueMQ.Publish(ctx, s.laneSubject(job.Priority), jobData, mq.WithMsgID(msgID)); err != nil {
 		return fmt.Errorf("error publishing job: %w", err)
 	}
 
-	s.log.Debug("Job queued", map[string]interface{}{"job_id": id})
+	s.log.Debug("Job queued", map[string]interface{}{"job_id": job.ID, "priority": string(job.Priority)})
 	return nil
 }
 
-// processJob unmarshals the job data and executes the registered handler.
-func (s *JobService) processJob(ctx context.Context, msgData []byte) error {
-	var job Job
-	if err := json.Unmarshal(msgData, &job); err != nil {
-		return fmt.Errorf("error unmarshalling job data: %w", err)
+// retryPolicy returns the retry policy registered for a schema.
+func (s *JobService) retryPolicy(schema string) RetryPolicy {
+	if h, ok := s.handlers[schema]; ok {
+		return h.retry
 	}
+	return DefaultRetryPolicy
+}
 
-	handler, exists := s.handlers[job.Schema]
+// processJob executes the registered handler for a job.
+func (s *JobService) processJob(ctx context.Context, job Job) error {
+	h, exists := s.handlers[job.Schema]
 	if !exists {
-		s.updateJobStatus(ctx, job.ID, StatusError)
-		return fmt.Errorf("no handler registered for schema: %s", job.Schema)
+		return fmt.Errorf("%w: %s", ErrNoHandler, job.Schema)
+	}
+	if job.Version != h.jobType.Version {
+		return fmt.Errorf("%w: job %s was queued for %s version %d, this worker runs version %d",
+			ErrVersionMismatch, job.ID, job.Schema, job.Version, h.jobType.Version)
+	}
+	inputs, err := h.decodeInputs(job.Inputs)
+	if err != nil {
+		return err
+	}
+
+	jobCtx, ok := s.startJob(ctx, job)
+	if !ok {
+		s.log.Info("Skipping cancelled job", map[string]interface{}{"job_id": job.ID})
+		return nil
+	}
+	defer s.finishJob(job.ID)
+
+	if job.Timeout > 0 {
+		var cancel context.CancelFunc
+		jobCtx, cancel = context.WithTimeoutCause(jobCtx, job.Timeout, ErrJobTimeout)
+		defer cancel()
 	}
 
-	if err := s.updateJobStatus(ctx, job.ID, StatusProcessing); err != nil {
+	if err := s.updateJobStatus(ctx, job.ID, StatusProcessing, ""); err != nil {
 		return err
 	}
 
-	if err := handler(ctx, job.Inputs); err != nil {
-		s.updateJobStatus(ctx, job.ID, StatusError)
+	if err := h.jobType.handle(jobCtx, inputs); err != nil {
+		if errors.Is(context.Cause(jobCtx), ErrJobCancelled) {
+			s.log.Info("Job cancelled", map[string]interface{}{"job_id": job.ID})
+			return nil
+		}
+		if errors.Is(context.Cause(jobCtx), ErrJobTimeout) {
+			return fmt.Errorf("%w after %s (job_id: %s)", ErrJobTimeout, job.Timeout, job.ID)
+		}
 		return fmt.Errorf("error processing job (job_id: %s): %w", job.ID, err)
 	}
 
-	return s.updateJobStatus(ctx, job.ID, StatusCompleted)
+	// The job itself succeeded, so a failed status update must not cause it to run again.
+	if err := s.updateJobStatus(ctx, job.ID, StatusCompleted, ""); err != nil {
+		s.log.Error("Failed to update job status", map[string]interface{}{"job_id": job.ID, "error": err.Error()})
+	}
+	return nil
+}
+
+// alreadyHandled reports whether a job must not start because its latest status shows it has
+// finished or is running from another copy of the job. A processing status is only trusted if the
+// job has not run from this message before; otherwise it was left behind by a worker that stopped.
+func (s *JobService) alreadyHandled(ctx context.Context, id string, rerun bool) (string, bool) {
+	last, err := s.eventMQ.LastMessage(ctx, s.statusSubject(id))
+	if err != nil {
+		if !errors.Is(err, mq.ErrMessageNotFound) {
+			s.log.Error("Failed to load job status", map[string]interface{}{"job_id": id, "error": err.Error()})
+		}
+		return "", false
+	}
+	var event Event[StatusEventMetadata]
+	if err := json.Unmarshal(last.Data, &event); err != nil {
+		return "", false
+	}
+
+	status := event.MetaData.Status
+	switch {
+	case status.IsTerminal():
+		return fmt.Sprintf("job is already %s", status), true
+	case status == StatusProcessing && !rerun:
+		return "job is already processing", true
+	}
+	return "", false
+}
+
+// handleJobMessage processes a pulled job, then acks it, schedules a retry or dead-letters it.
+func (s *JobService) handleJobMessage(ctx context.Context, p *pendingJob) {
+	msg, job := p.msg, p.job
+	defer p.stopHeartbeat()
+
+	// Attempts are recorded outside the message, so deliveries handed back unrun do not count.
+	var seq uint64
+	if meta, err := msg.Metadata(); err == nil {
+		seq = meta.Sequence.Stream
+	}
+	previous := s.previousAttempts(ctx, job.ID, seq)
+
+	if reason, handled := s.alreadyHandled(ctx, job.ID, previous > 0); handled {
+		s.log.Warn("Refusing to start job", map[string]interface{}{"job_id": job.ID, "reason": reason})
+		if termErr := msg.TermWithReason(reason); termErr != nil {
+			s.log.Error("Failed to terminate message", map[string]interface{}{"error": termErr.Error()})
+		}
+		return
+	}
+	attempt := previous + 1
+	s.recordAttempt(ctx, job.ID, attempt, seq)
+
+	err := s.processJob(resources.WithReservation(ctx, p.reservation), job)
+
+	if ctx.Err() != nil {
+		// The worker stopped before the job finished; hand it to another worker straight away.
+		// The interrupted run is not held against the job.
+		s.recordAttempt(context.WithoutCancel(ctx), job.ID, previous, seq)
+		s.requeue(ctx, p)
+		return
+	}
+	if err == nil {
+		s.log.Debug("Job processed successfully", map[string]interface{}{"job_id": job.ID})
+		if ackErr := msg.Ack(); ackErr != nil {
+			s.log.Error("Failed to acknowledge message", map[string]interface{}{"error": ackErr.Error()})
+		}
+		return
+	}
+	s.log.Error("Failed to process job", map[string]interface{}{"job_id": job.ID, "attempt": attempt, "error": err.Error()})
+
+	if errors.Is(err, ErrJobTimeout) {
+		reason := fmt.Sprintf("exceeded its maximum runtime of %s", job.Timeout)
+		if statusErr := s.updateJobStatus(ctx, job.ID, StatusTimeout, reason); statusErr != nil {
+			s.log.Error("Failed to update job status", map[string]interface{}{"job_id": job.ID, "error": statusErr.Error()})
+		}
+		if termErr := msg.TermWithReason(reason); termErr != nil {
+			s.log.Error("Failed to terminate message", map[string]interface{}{"error": termErr.Error()})
+		}
+		return
+	}
+
+	policy := s.retryPolicy(job.Schema)
+	if errors.Is(err, ErrNoHandler) || errors.Is(err, ErrVersionMismatch) || errors.Is(err, ErrInvalidInputs) || attempt >= policy.MaxAttempts {
+		s.deadLetter(ctx, msg, job, err, attempt)
+		return
+	}
+
+	delay := policy.Backoff(attempt)
+	reason := fmt.Sprintf("attempt %d of %d failed, retrying in %s: %v", attempt, policy.MaxAttempts, delay, err)
+	if statusErr := s.updateJobStatus(ctx, job.ID, StatusRetrying, reason); statusErr != nil {
+		s.log.Error("Failed to update job status", map[string]interface{}{"job_id": job.ID, "error": statusErr.Error()})
+	}
+	if nakErr := msg.NakWithDelay(delay); nakErr != nil {
+		s.log.Error("Failed to nak message", map[string]interface{}{"error": nakErr.Error()})
+	}
 }
 
-// Process subscribes to job requests and processes them concurrently up to maxConcurrency.
-func (s *JobService) Process(ctx context.Context, maxConcurrency int) error {
-	semaphore := make(chan struct{}, maxConcurrency)
-	subject := fmt.Sprintf("%s.request", s.subjectPrefix)
-	consumerName := "request-worker"
+// heartbeat periodically tells the server that a message is still being worked on,
+// so it is only redelivered if this worker stops responding. The returned function stops it.
+func (s *JobService) heartbeat(msg jetstream.Msg) func() {
+	interval := s.cfg.Worker.AckWait / 3
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
 
-	return s.workQueueMQ.Subscribe(ctx, subject, consumerName, func(msg jetstream.Msg) {
-		semaphore <- struct{}{}
-		go func() {
-			defer func() { <-semaphore }()
-			if err := s.processJob(ctx, msg.Data()); err != nil {
-				s.log.Error("Failed to process job", map[string]interface{}{"error": err.Error()})
-			} else {
-				s.log.Debug("Job processed successfully", nil)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := msg.InProgress(); err != nil {
+					s.log.Warn("Failed to send job heartbeat", map[string]interface{}{"error": err.Error()})
+				}
 			}
-		}()
-	})
+		}
+	}()
+	return func() { close(done) }
 }
 
 // RegisterJobHandler registers a handler for jobs with the specified schema.
-func (s *JobService) RegisterJobHandler(schema string, handler JobHandler) {
-	s.handlers[schema] = handler
-	s.log.Debug("Job handler registered", map[string]interface{}{"job_schema": schema})
+// Its inputs are passed as generic JSON values; use RegisterJobType for typed inputs.
+func (s *JobService) RegisterJobHandler(schema string, handler JobHandler, opts ...HandlerOption) {
+	s.RegisterJobType(untypedJob(schema, handler), opts...)
 }
 
-// Subscribe subscribes to job status events.
-func (s *JobService) Subscribe(ctx context.Context, subject string, consumerName string, handler func(jetstream.Msg)) error {
+// Subscribe subscribes to job events through a durable consumer.
+// Options only apply when the consumer is first created; by default it starts with the first stored event.
+func (s *JobService) Subscribe(ctx context.Context, subject string, consumerName string, handler func(jetstream.Msg), opts ...mq.SubscribeOption) error {
 	finalSubject := fmt.Sprintf("%s.events.%s", s.subjectPrefix, subject)
-	return s.eventMQ.Subscribe(ctx, finalSubject, consumerName, handler)
+	return s.eventMQ.Subscribe(ctx, finalSubject, consumerName, handler, opts...)
 }
 
-// ReplaySubscribe creates an ephemeral subscription that replays all matching events.
-func (s *JobService) ReplaySubscribe(ctx context.Context, subject string, handler func(jetstream.Msg)) error {
+// ReplaySubscribe creates an ephemeral subscription that replays all matching events,
+// or starts from the position chosen by the options.
+func (s *JobService) ReplaySubscribe(ctx context.Context, subject string, handler func(jetstream.Msg), opts ...mq.SubscribeOption) error {
 	finalSubject := fmt.Sprintf("%s.events.%s", s.subjectPrefix, subject)
-	// Create an ephemeral consumer configuration by not setting Durable.
-	consumerConfig := jetstream.ConsumerConfig{
-		AckPolicy:     jetstream.AckExplicitPolicy,
-		DeliverPolicy: jetstream.DeliverAllPolicy,
-		FilterSubject: finalSubject,
-	}
-	jsMQ, ok := s.eventMQ.(*mq.JetStreamMessageQueueService)
-	if !ok {
-		return fmt.Errorf("unable to type assert eventMQ to *mq.JetStreamMessageQueueService")
-	}
-	return jsMQ.SubscribeWithConfig(ctx, consumerConfig, handler)
+	return s.eventMQ.Subscribe(ctx, finalSubject, "", handler, opts...)
 }
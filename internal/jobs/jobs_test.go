@@ -0,0 +1,284 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aligndx/aligndx/internal/config"
+	"github.com/aligndx/aligndx/internal/jobs/mq"
+	"github.com/aligndx/aligndx/internal/logger"
+)
+
+// newTestJobService returns a job service on a memory broker of its own.
+func newTestJobService(t *testing.T) *JobService {
+	t.Helper()
+	memoryBroker = sync.OnceValue(mq.NewMemoryBroker)
+	cfg := config.NewConfigManager().GetConfig()
+	cfg.MQ.Backend = config.MQBackendMemory
+	ctx := context.Background()
+	s, err := NewJobService(ctx, logger.NewLoggerWrapper("test", ctx), cfg)
+	if err != nil {
+		t.Fatalf("NewJobService: %v", err)
+	}
+	return s.(*JobService)
+}
+
+// startWorker runs the service's worker until the test ends.
+func startWorker(t *testing.T, s *JobService, maxConcurrency int) {
+	t.Helper()
+	ctx, stop := context.WithCancel(context.Background())
+	if err := s.Process(ctx, maxConcurrency); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	t.Cleanup(func() {
+		stop()
+		drainCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.Drain(drainCtx)
+	})
+}
+
+// waitFor fails the test if a value is not received in time.
+func waitFor[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+	var zero T
+	return zero
+}
+
+// eventually fails the test if cond does not hold in time.
+func eventually(t *testing.T, cond func() bool, what string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// lastStatus returns the latest status published for a job.
+func lastStatus(t *testing.T, s *JobService, id string) StatusEventMetadata {
+	t.Helper()
+	msg, err := s.eventMQ.LastMessage(context.Background(), s.statusSubject(id))
+	if err != nil {
+		t.Fatalf("LastMessage(%s): %v", s.statusSubject(id), err)
+	}
+	var event Event[StatusEventMetadata]
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		t.Fatalf("Unmarshal status: %v", err)
+	}
+	return event.MetaData
+}
+
+// queuedJobs returns the IDs of the jobs waiting in the normal lane, leaving them queued.
+func queuedJobs(t *testing.T, s *JobService) []string {
+	t.Helper()
+	msgs, err := s.workQueueMQ.Fetch(context.Background(), s.laneSubject(PriorityNormal), "request-worker-normal", mq.ConsumerLimits{AckWait: time.Minute}, 10)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	var ids []string
+	for _, msg := range msgs {
+		var job Job
+		if err := json.Unmarshal(msg.Data(), &job); err != nil {
+			t.Fatalf("Unmarshal job: %v", err)
+		}
+		ids = append(ids, job.ID)
+		if err := msg.Nak(); err != nil {
+			t.Fatalf("Nak: %v", err)
+		}
+	}
+	return ids
+}
+
+func TestQueueDropsDuplicates(t *testing.T) {
+	s := newTestJobService(t)
+	s.RegisterJobHandler("test", func(ctx context.Context, inputs interface{}) error { return nil })
+	ctx := context.Background()
+
+	for range 2 {
+		if err := s.Queue(ctx, "job", map[string]interface{}{}, "test"); err != nil {
+			t.Fatalf("Queue: %v", err)
+		}
+	}
+	if ids := queuedJobs(t, s); len(ids) != 1 {
+		t.Fatalf("queued %v, want the job once", ids)
+	}
+	if status := lastStatus(t, s, "job"); status.Status != StatusQueued {
+		t.Fatalf("status = %s, want queued", status.Status)
+	}
+
+	// A fresh deduplication ID queues the job again.
+	if err := s.Queue(ctx, "job", map[string]interface{}{}, "test", WithDeduplicationID("job-rerun")); err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+	if ids := queuedJobs(t, s); len(ids) != 2 {
+		t.Fatalf("queued %v, want the job twice", ids)
+	}
+}
+
+func TestCancelQueuedJob(t *testing.T) {
+	s := newTestJobService(t)
+	ran := make(chan string, 2)
+	s.RegisterJobHandler("test", func(ctx context.Context, inputs interface{}) error {
+		ran <- inputs.(map[string]interface{})["name"].(string)
+		return nil
+	})
+	ctx := context.Background()
+
+	for _, name := range []string{"cancelled", "kept"} {
+		if err := s.Queue(ctx, name, map[string]interface{}{"name": name}, "test"); err != nil {
+			t.Fatalf("Queue: %v", err)
+		}
+	}
+	if err := s.Cancel(ctx, "cancelled"); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+
+	startWorker(t, s, 1)
+	// Jobs are pulled in order, so the cancelled job has been skipped once the next one runs.
+	if name := waitFor(t, ran, "the kept job to run"); name != "kept" {
+		t.Fatalf("ran %s, want only the kept job", name)
+	}
+	if status := lastStatus(t, s, "cancelled"); status.Status != StatusCancelled {
+		t.Fatalf("status = %s, want cancelled", status.Status)
+	}
+}
+
+func TestRetriesExhaustedDeadLetterJob(t *testing.T) {
+	s := newTestJobService(t)
+	var mu sync.Mutex
+	runs := 0
+	s.RegisterJobHandler("test", func(ctx context.Context, inputs interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		runs++
+		return errors.New("boom")
+	}, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond}))
+	ctx := context.Background()
+
+	if err := s.Queue(ctx, "failing", map[string]interface{}{}, "test"); err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+	startWorker(t, s, 1)
+
+	var entry *DeadLetter
+	eventually(t, func() bool {
+		var err error
+		entry, err = s.GetDeadLetter(ctx, "failing")
+		return err == nil
+	}, "the job to be dead-lettered")
+	if entry.Attempts != 3 || entry.Error == "" {
+		t.Fatalf("dead letter = %+v, want 3 attempts and the error", entry)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if runs != 3 {
+		t.Fatalf("handler ran %d times, want 3", runs)
+	}
+	if status := lastStatus(t, s, "failing"); status.Status != StatusError {
+		t.Fatalf("status = %s, want error", status.Status)
+	}
+}
+
+func TestDrainRequeuesRunningJob(t *testing.T) {
+	s := newTestJobService(t)
+	started := make(chan struct{}, 1)
+	s.RegisterJobHandler("test", func(ctx context.Context, inputs interface{}) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return context.Cause(ctx)
+	}, WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+
+	ctx, stop := context.WithCancel(context.Background())
+	if err := s.Queue(ctx, "long", map[string]interface{}{}, "test"); err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+	if err := s.Process(ctx, 1); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	waitFor(t, started, "the job to start")
+
+	stop()
+	expired, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Drain(expired); !errors.Is(err, ErrWorkerStopping) {
+		t.Fatalf("Drain = %v, want ErrWorkerStopping", err)
+	}
+
+	if status := lastStatus(t, s, "long"); status.Status != StatusQueued {
+		t.Fatalf("status = %s, want queued", status.Status)
+	}
+	if _, err := s.GetDeadLetter(context.Background(), "long"); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Fatalf("GetDeadLetter = %v, want the interrupted run not to count as its only attempt", err)
+	}
+	if ids := queuedJobs(t, s); len(ids) != 1 || ids[0] != "long" {
+		t.Fatalf("queued %v, want the interrupted job back in the queue", ids)
+	}
+}
+
+func TestLegacyJobsMovedToNormalLane(t *testing.T) {
+	s := newTestJobService(t)
+	ran := make(chan string, 1)
+	s.RegisterJobHandler("test", func(ctx context.Context, inputs interface{}) error {
+		ran <- "legacy"
+		return nil
+	})
+
+	data, err := json.Marshal(Job{ID: "legacy", Inputs: json.RawMessage(`{}`), Schema: "test", Version: s.handlers["test"].jobType.Version})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.workQueueMQ.Publish(context.Background(), s.legacyRequestSubject(), data); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	startWorker(t, s, 1)
+	if id := waitFor(t, ran, "the legacy job to run"); id != "legacy" {
+		t.Fatalf("ran %s, want legacy", id)
+	}
+}
+
+func TestUserCapCountsOtherWorkers(t *testing.T) {
+	s := newTestJobService(t)
+	s.cfg.Worker.MaxJobsPerUser = 2
+	s.SetWorkerID("self")
+	d, err := newDispatcher(s, 4)
+	if err != nil {
+		t.Fatalf("newDispatcher: %v", err)
+	}
+
+	ctx := context.Background()
+	for _, info := range []WorkerInfo{
+		{ID: "other", State: WorkerRunning, RunningUsers: map[string]int{"alice": 1}},
+		{ID: "self", State: WorkerRunning, RunningUsers: map[string]int{"alice": 1}}, // Counted in d.running
+		{ID: "gone", State: WorkerStopped, RunningUsers: map[string]int{"alice": 1}},
+	} {
+		if err := s.PublishWorkerHeartbeat(ctx, info); err != nil {
+			t.Fatalf("PublishWorkerHeartbeat: %v", err)
+		}
+	}
+	d.countElsewhere(ctx)
+
+	if !d.hasCapacity("alice") {
+		t.Fatal("alice is capped with one job running on another worker")
+	}
+	d.running["alice"]++
+	if d.hasCapacity("alice") {
+		t.Fatal("alice may start a third job across the workers")
+	}
+	if !d.hasCapacity("bob") {
+		t.Fatal("bob is capped without running jobs")
+	}
+}
@@ -0,0 +1,128 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidInputs is returned when a job's inputs do not decode into its type or fail its validation.
+// Such jobs are not queued, and are not retried if they reach a worker.
+var ErrInvalidInputs = errors.New("invalid job inputs")
+
+// ErrVersionMismatch is returned when a job was queued for a different version of its type
+// than the worker runs. Such jobs are dead-lettered so they can be requeued once versions agree.
+var ErrVersionMismatch = errors.New("job version mismatch")
+
+// Definition describes a typed job: the schema it is queued under, the version of its
+// input type, how its inputs are validated and how they are handled.
+type Definition[T any] struct {
+	Schema   string
+	Version  int
+	Validate func(inputs T) error
+	Handle   func(ctx context.Context, inputs T) error
+}
+
+// JobType is a Definition with its input type erased, ready to be registered.
+type JobType struct {
+	Schema   string
+	Version  int
+	decode   func(raw json.RawMessage) (interface{}, error)
+	validate func(inputs interface{}) error
+	handle   JobHandler
+}
+
+// Define erases the input type of a definition so it can be registered with a job service.
+func Define[T any](def Definition[T]) JobType {
+	return JobType{
+		Schema:  def.Schema,
+		Version: def.Version,
+		decode: func(raw json.RawMessage) (interface{}, error) {
+			var inputs T
+			if err := json.Unmarshal(raw, &inputs); err != nil {
+				return nil, err
+			}
+			return inputs, nil
+		},
+		validate: func(inputs interface{}) error {
+			if def.Validate == nil {
+				return nil
+			}
+			return def.Validate(inputs.(T))
+		},
+		handle: func(ctx context.Context, inputs interface{}) error {
+			return def.Handle(ctx, inputs.(T))
+		},
+	}
+}
+
+// untypedJob wraps a plain handler, which receives its inputs decoded into generic JSON values.
+func untypedJob(schema string, handler JobHandler) JobType {
+	return JobType{
+		Schema: schema,
+		decode: func(raw json.RawMessage) (interface{}, error) {
+			var inputs interface{}
+			if err := json.Unmarshal(raw, &inputs); err != nil {
+				return nil, err
+			}
+			return inputs, nil
+		},
+		validate: func(interface{}) error { return nil },
+		handle:   handler,
+	}
+}
+
+// RegisterJobType registers a typed job, replacing any job registered under the same schema.
+func (s *JobService) RegisterJobType(t JobType, opts ...HandlerOption) {
+	h := registeredHandler{jobType: t, retry: DefaultRetryPolicy}
+	for _, opt := range opts {
+		opt(&h)
+	}
+	s.handlers[t.Schema] = h
+	s.log.Debug("Job type registered", map[string]interface{}{"job_schema": t.Schema, "job_version": t.Version})
+}
+
+// JobTypes returns the version of every registered job schema.
+func (s *JobService) JobTypes() map[string]int {
+	types := make(map[string]int, len(s.handlers))
+	for schema, h := range s.handlers {
+		types[schema] = h.jobType.Version
+	}
+	return types
+}
+
+// Validate checks that inputs are valid for a registered schema.
+func (s *JobService) Validate(schema string, inputs interface{}) error {
+	_, err := s.encodeInputs(schema, inputs)
+	return err
+}
+
+// encodeInputs validates inputs for a schema and returns them as JSON.
+func (s *JobService) encodeInputs(schema string, inputs interface{}) (json.RawMessage, error) {
+	h, ok := s.handlers[schema]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoHandler, schema)
+	}
+
+	raw, err := json.Marshal(inputs)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInputs, err)
+	}
+	if _, err := h.decodeInputs(raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// decodeInputs decodes and validates the inputs of a job.
+func (h registeredHandler) decodeInputs(raw json.RawMessage) (interface{}, error) {
+	inputs, err := h.jobType.decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInputs, err)
+	}
+	if err := h.jobType.validate(inputs); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInputs, err)
+	}
+	return inputs, nil
+}
@@ -0,0 +1,195 @@
+package mq
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aligndx/aligndx/internal/config"
+	"github.com/aligndx/aligndx/internal/logger"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Connection is a NATS connection shared by the message queue services of one process.
+// It reconnects on its own and keeps track of its state for health checks.
+type Connection struct {
+	nc *nats.Conn
+	js jetstream.JetStream
+
+	mu             sync.Mutex
+	disconnectedAt time.Time
+	lastError      string
+}
+
+// ConnectionHealth describes the state of the message queue connection.
+type ConnectionHealth struct {
+	Backend        string     `json:"backend"`
+	Status         string     `json:"status"`
+	Healthy        bool       `json:"healthy"`
+	Reconnects     uint64     `json:"reconnects"`
+	DisconnectedAt *time.Time `json:"disconnected_at,omitempty"` // Set while the connection is down
+	LastError      string     `json:"last_error,omitempty"`
+}
+
+// Connect opens a NATS connection using the configured authentication, TLS and reconnect settings.
+func Connect(cfg config.MQConfig, log *logger.LoggerWrapper) (*Connection, error) {
+	c := &Connection{}
+
+	opts, err := connectOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts,
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			fields := map[string]interface{}{}
+			c.mu.Lock()
+			c.disconnectedAt = time.Now()
+			if err != nil {
+				c.lastError = err.Error()
+				fields["error"] = err.Error()
+			}
+			c.mu.Unlock()
+			log.Warn("Disconnected from NATS server", fields)
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			c.mu.Lock()
+			down := time.Since(c.disconnectedAt)
+			c.disconnectedAt = time.Time{}
+			c.mu.Unlock()
+			log.Info("Reconnected to NATS server", map[string]interface{}{
+				"url":        nc.ConnectedUrlRedacted(),
+				"downtime":   down.String(),
+				"reconnects": nc.Stats().Reconnects,
+			})
+		}),
+		nats.ClosedHandler(func(nc *nats.Conn) {
+			fields := map[string]interface{}{}
+			if err := nc.LastError(); err != nil {
+				fields["error"] = err.Error()
+			}
+			log.Warn("NATS connection closed", fields)
+		}),
+		nats.ErrorHandler(func(nc *nats.Conn, sub *nats.Subscription, err error) {
+			c.mu.Lock()
+			c.lastError = err.Error()
+			c.mu.Unlock()
+			fields := map[string]interface{}{"error": err.Error()}
+			if sub != nil {
+				fields["subject"] = sub.Subject
+			}
+			log.Error("NATS error", fields)
+		}),
+	)
+
+	nc, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		log.Error("Failed to connect to NATS server", map[string]interface{}{
+			"url":   cfg.URL,
+			"error": err.Error(),
+		})
+		return nil, fmt.Errorf("failed to connect to NATS server: %w", err)
+	}
+	log.Debug("Connected to NATS server", map[string]interface{}{
+		"url": nc.ConnectedUrlRedacted(),
+	})
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		log.Error("Failed to initialize JetStream", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return nil, fmt.Errorf("failed to initialize JetStream: %w", err)
+	}
+	log.Debug("JetStream initialized", nil)
+
+	c.nc, c.js = nc, js
+	return c, nil
+}
+
+// connectOptions translates the message queue configuration into NATS connection options.
+func connectOptions(cfg config.MQConfig) ([]nats.Option, error) {
+	opts := []nats.Option{
+		nats.Name("aligndx"),
+		nats.MaxReconnects(cfg.MaxReconnects),
+		nats.CustomReconnectDelay(reconnectDelay(cfg.ReconnectWait, cfg.MaxReconnectWait)),
+	}
+	if cfg.ConnectTimeout > 0 {
+		opts = append(opts, nats.Timeout(cfg.ConnectTimeout))
+	}
+
+	// Authentication: at most one method may be configured.
+	methods := 0
+	for _, set := range []bool{cfg.CredsFile != "", cfg.NKeyFile != "", cfg.Token != "", cfg.User != ""} {
+		if set {
+			methods++
+		}
+	}
+	if methods > 1 {
+		return nil, fmt.Errorf("only one NATS authentication method may be configured (creds file, nkey, token or user/password)")
+	}
+	switch {
+	case cfg.CredsFile != "":
+		opts = append(opts, nats.UserCredentials(cfg.CredsFile))
+	case cfg.NKeyFile != "":
+		opt, err := nats.NkeyOptionFromSeed(cfg.NKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load NATS nkey seed (path: %s): %w", cfg.NKeyFile, err)
+		}
+		opts = append(opts, opt)
+	case cfg.Token != "":
+		opts = append(opts, nats.Token(cfg.Token))
+	case cfg.User != "":
+		opts = append(opts, nats.UserInfo(cfg.User, cfg.Password))
+	}
+
+	// TLS: a CA verifies the server, a certificate and key authenticate the client.
+	if cfg.TLSCA != "" {
+		opts = append(opts, nats.RootCAs(cfg.TLSCA))
+	}
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		if cfg.TLSCert == "" || cfg.TLSKey == "" {
+			return nil, fmt.Errorf("NATS TLS client authentication needs both a certificate and a key")
+		}
+		opts = append(opts, nats.ClientCert(cfg.TLSCert, cfg.TLSKey))
+	}
+	return opts, nil
+}
+
+// reconnectDelay backs off exponentially from wait up to maxWait between reconnect attempts, with up to 20% jitter.
+func reconnectDelay(wait, maxWait time.Duration) nats.ReconnectDelayHandler {
+	if wait <= 0 {
+		wait = nats.DefaultReconnectWait
+	}
+	maxWait = max(maxWait, wait)
+	return func(attempts int) time.Duration {
+		delay := wait
+		for i := 1; i < attempts && delay < maxWait; i++ {
+			delay *= 2
+		}
+		delay = min(delay, maxWait)
+		return delay + rand.N(delay/5+1)
+	}
+}
+
+// Health reports the state of the connection. Only a connected connection is healthy.
+func (c *Connection) Health() ConnectionHealth {
+	status := c.nc.Status()
+	health := ConnectionHealth{
+		Backend:    config.MQBackendJetStream,
+		Status:     strings.ToLower(status.String()),
+		Healthy:    status == nats.CONNECTED,
+		Reconnects: c.nc.Stats().Reconnects,
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !health.Healthy && !c.disconnectedAt.IsZero() {
+		disconnectedAt := c.disconnectedAt
+		health.DisconnectedAt = &disconnectedAt
+	}
+	health.LastError = c.lastError
+	return health
+}
@@ -4,43 +4,50 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/aligndx/aligndx/internal/logger"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 )
 
+// ErrMessageNotFound is returned when no stored message matches a lookup.
+var ErrMessageNotFound = errors.New("message not found")
+
+// ErrNoResponders is returned when a request is sent to a subject nobody answers.
+var ErrNoResponders = errors.New("no responders")
+
+// StoredMessage is a message read directly from a stream rather than through a consumer.
+type StoredMessage struct {
+	Subject  string
+	Sequence uint64
+	Data     []byte
+	Time     time.Time
+}
+
+// ConsumerLimits bounds how long and how many messages a consumer may hold without acknowledging them.
+// The limits belong to the consumer, so they apply to every client fetching through it together.
+type ConsumerLimits struct {
+	AckWait       time.Duration
+	MaxAckPending int // Zero uses the server default
+}
+
 type JetStreamMessageQueueService struct {
+	nc         *nats.Conn
 	js         jetstream.JetStream
 	streamName string
 	log        *logger.LoggerWrapper
-}
-
-// NewJetStreamMessageQueueService creates a new JetStream message queue service using a full stream configuration.
-func NewJetStreamMessageQueueService(ctx context.Context, url string, streamConfig jetstream.StreamConfig, log *logger.LoggerWrapper) (*JetStreamMessageQueueService, error) {
-	nc, err := nats.Connect(url)
-	if err != nil {
-		log.Error("Failed to connect to NATS server", map[string]interface{}{
-			"url":   url,
-			"error": err.Error(),
-		})
-		return nil, fmt.Errorf("failed to connect to NATS server: %w", err)
-	}
-	log.Debug("Connected to NATS server", map[string]interface{}{
-		"url": url,
-	})
-
-	js, err := jetstream.New(nc)
-	if err != nil {
-		log.Error("Failed to initialize JetStream", map[string]interface{}{
-			"error": err.Error(),
-		})
-		return nil, fmt.Errorf("failed to initialize JetStream: %w", err)
-	}
 
-	log.Debug("JetStream initialized", nil)
+	mu        sync.Mutex
+	consumers map[string]jetstream.Consumer
+}
 
-	_, err = js.CreateStream(ctx, streamConfig)
+// NewJetStreamMessageQueueService creates a new JetStream message queue service on a shared connection using a full stream configuration.
+func NewJetStreamMessageQueueService(ctx context.Context, conn *Connection, streamConfig jetstream.StreamConfig, log *logger.LoggerWrapper) (*JetStreamMessageQueueService, error) {
+	js := conn.js
+	_, err := js.CreateStream(ctx, streamConfig)
 	if err != nil {
 		if !errors.Is(err, jetstream.ErrStreamNameAlreadyInUse) {
 			log.Error("Failed to create stream", map[string]interface{}{
@@ -50,10 +57,13 @@ func NewJetStreamMessageQueueService(ctx context.Context, url string, streamConf
 			})
 			return nil, fmt.Errorf("failed to create stream (streamName: %s, subjects: %v): %w", streamConfig.Name, streamConfig.Subjects, err)
 		} else {
-			log.Warn("Stream already exists", map[string]interface{}{
+			log.Debug("Stream already exists", map[string]interface{}{
 				"streamName": streamConfig.Name,
 				"subjects":   streamConfig.Subjects,
 			})
+			if err := reconcileStream(ctx, js, streamConfig, log); err != nil {
+				return nil, err
+			}
 		}
 	} else {
 		log.Debug("Stream created", map[string]interface{}{
@@ -63,18 +73,51 @@ func NewJetStreamMessageQueueService(ctx context.Context, url string, streamConf
 	}
 
 	return &JetStreamMessageQueueService{
+		nc:         conn.nc,
 		js:         js,
 		streamName: streamConfig.Name,
 		log:        log,
+		consumers:  make(map[string]jetstream.Consumer),
 	}, nil
 }
 
-// Publish sends a message to the given subject.
-func (s *JetStreamMessageQueueService) Publish(ctx context.Context, subject string, data []byte) error {
-	_, err := s.js.Publish(ctx, subject, data)
+// PublishOption configures a published message.
+type PublishOption func(*publishOptions)
+
+type publishOptions struct {
+	msgID string
+}
+
+// WithMsgID sets the ID JetStream uses to drop a message published again within the stream's duplicate window.
+func WithMsgID(id string) PublishOption {
+	return func(o *publishOptions) {
+		o.msgID = id
+	}
+}
+
+// Publish sends a message to the given subject. A message whose ID was already published
+// within the duplicate window is dropped by the server and is not an error.
+func (s *JetStreamMessageQueueService) Publish(ctx context.Context, subject string, data []byte, opts ...PublishOption) error {
+	var o publishOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var jsOpts []jetstream.PublishOpt
+	if o.msgID != "" {
+		jsOpts = append(jsOpts, jetstream.WithMsgID(o.msgID))
+	}
+
+	ack, err := s.js.Publish(ctx, subject, data, jsOpts...)
 	if err != nil {
 		return fmt.Errorf("failed to publish message (subject: %s): %w", subject, err)
 	}
+	if ack.Duplicate {
+		s.log.Info("Duplicate message dropped", map[string]interface{}{
+			"subject": subject,
+			"msg_id":  o.msgID,
+		})
+		return nil
+	}
 	s.log.Debug("Message published", map[string]interface{}{
 		"subject": subject,
 	})
@@ -82,7 +125,23 @@ func (s *JetStreamMessageQueueService) Publish(ctx context.Context, subject stri
 }
 
 // SubscribeWithConfig subscribes using a provided consumer configuration.
+// Messages are acknowledged once the handler returns.
 func (s *JetStreamMessageQueueService) SubscribeWithConfig(ctx context.Context, consumerConfig jetstream.ConsumerConfig, handler func(jetstream.Msg)) error {
+	return s.ConsumeWithConfig(ctx, consumerConfig, func(msg jetstream.Msg) {
+		handler(msg)
+		if ackErr := msg.Ack(); ackErr != nil {
+			s.log.Error("Failed to acknowledge message", map[string]interface{}{
+				"error": ackErr.Error(),
+			})
+		} else {
+			s.log.Debug("Message acknowledged", nil)
+		}
+	})
+}
+
+// ConsumeWithConfig consumes using a provided consumer configuration.
+// Messages are not acknowledged; the handler is responsible for acking, naking or terminating them.
+func (s *JetStreamMessageQueueService) ConsumeWithConfig(ctx context.Context, consumerConfig jetstream.ConsumerConfig, handler func(jetstream.Msg)) error {
 	cons, err := s.js.CreateOrUpdateConsumer(ctx, s.streamName, consumerConfig)
 	if err != nil {
 		return fmt.Errorf("failed to create or update consumer (streamName: %s): %w", s.streamName, err)
@@ -99,13 +158,6 @@ func (s *JetStreamMessageQueueService) SubscribeWithConfig(ctx context.Context,
 			"data":       string(msg.Data()),
 		})
 		handler(msg)
-		if ackErr := msg.Ack(); ackErr != nil {
-			s.log.Error("Failed to acknowledge message", map[string]interface{}{
-				"error": ackErr.Error(),
-			})
-		} else {
-			s.log.Debug("Message acknowledged", nil)
-		}
 	})
 	if err != nil {
 		return fmt.Errorf("failed to start consuming messages: %w", err)
@@ -120,13 +172,189 @@ func (s *JetStreamMessageQueueService) SubscribeWithConfig(ctx context.Context,
 }
 
 // Subscribe implements the MessageQueueService interface.
-// It constructs a consumer config from the given subject and consumerName and then calls SubscribeWithConfig.
-func (s *JetStreamMessageQueueService) Subscribe(ctx context.Context, subject string, consumerName string, handler func(jetstream.Msg)) error {
-	consumerConfig := jetstream.ConsumerConfig{
+// It constructs a consumer config from the given subject, consumerName and options and then calls SubscribeWithConfig.
+// An empty consumerName subscribes through an ephemeral consumer.
+func (s *JetStreamMessageQueueService) Subscribe(ctx context.Context, subject string, consumerName string, handler func(jetstream.Msg), opts ...SubscribeOption) error {
+	return s.SubscribeWithConfig(ctx, newConsumerConfig(subject, consumerName, opts), handler)
+}
+
+// Fetch implements the MessageQueueService interface.
+// It pulls up to batch messages that are available right now from a durable consumer with the given limits,
+// without waiting for new ones. Acknowledgement is left to the caller.
+func (s *JetStreamMessageQueueService) Fetch(ctx context.Context, subject string, consumerName string, limits ConsumerLimits, batch int) ([]jetstream.Msg, error) {
+	cons, err := s.pullConsumer(ctx, jetstream.ConsumerConfig{
 		Durable:       consumerName,
 		AckPolicy:     jetstream.AckExplicitPolicy,
 		DeliverPolicy: jetstream.DeliverAllPolicy,
 		FilterSubject: subject,
+		AckWait:       limits.AckWait,
+		MaxAckPending: limits.MaxAckPending,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	msgBatch, err := cons.FetchNoWait(batch)
+	if err == nil {
+		var msgs []jetstream.Msg
+		for msg := range msgBatch.Messages() {
+			msgs = append(msgs, msg)
+		}
+		if err = msgBatch.Error(); err == nil {
+			return msgs, nil
+		}
+	}
+
+	// Recreate the consumer on the next fetch in case it was removed from the server.
+	s.mu.Lock()
+	delete(s.consumers, consumerName)
+	s.mu.Unlock()
+	return nil, fmt.Errorf("failed to fetch messages (consumerName: %s): %w", consumerName, err)
+}
+
+// pullConsumer returns the durable consumer for a configuration, creating it on first use.
+func (s *JetStreamMessageQueueService) pullConsumer(ctx context.Context, consumerConfig jetstream.ConsumerConfig) (jetstream.Consumer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cons, ok := s.consumers[consumerConfig.Durable]; ok {
+		return cons, nil
+	}
+	cons, err := s.js.CreateOrUpdateConsumer(ctx, s.streamName, consumerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create or update consumer (streamName: %s): %w", s.streamName, err)
 	}
-	return s.SubscribeWithConfig(ctx, consumerConfig, handler)
+	s.log.Debug("Consumer created or updated", map[string]interface{}{
+		"streamName":   s.streamName,
+		"consumerName": consumerConfig.Durable,
+	})
+	s.consumers[consumerConfig.Durable] = cons
+	return cons, nil
+}
+
+// LastMessage returns the most recent message stored on the given subject.
+func (s *JetStreamMessageQueueService) LastMessage(ctx context.Context, subject string) (*StoredMessage, error) {
+	stream, err := s.js.Stream(ctx, s.streamName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stream (streamName: %s): %w", s.streamName, err)
+	}
+	msg, err := stream.GetLastMsgForSubject(ctx, subject)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, fmt.Errorf("failed to get last message (subject: %s): %w", subject, err)
+	}
+	return &StoredMessage{
+		Subject:  msg.Subject,
+		Sequence: msg.Sequence,
+		Data:     msg.Data,
+		Time:     msg.Time,
+	}, nil
+}
+
+// LastMessages returns the most recent message of every subject matching the filter, ordered by sequence.
+func (s *JetStreamMessageQueueService) LastMessages(ctx context.Context, filter string) ([]StoredMessage, error) {
+	stream, err := s.js.Stream(ctx, s.streamName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stream (streamName: %s): %w", s.streamName, err)
+	}
+	info, err := stream.Info(ctx, jetstream.WithSubjectFilter(filter))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stream info (streamName: %s): %w", s.streamName, err)
+	}
+
+	messages := make([]StoredMessage, 0, len(info.State.Subjects))
+	for subject := range info.State.Subjects {
+		msg, err := s.LastMessage(ctx, subject)
+		if err != nil {
+			if errors.Is(err, ErrMessageNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		messages = append(messages, *msg)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Sequence < messages[j].Sequence })
+	return messages, nil
+}
+
+// DeleteMessage removes the message with the given sequence from the stream.
+func (s *JetStreamMessageQueueService) DeleteMessage(ctx context.Context, seq uint64) error {
+	stream, err := s.js.Stream(ctx, s.streamName)
+	if err != nil {
+		return fmt.Errorf("failed to get stream (streamName: %s): %w", s.streamName, err)
+	}
+	if err := stream.DeleteMsg(ctx, seq); err != nil {
+		return fmt.Errorf("failed to delete message (streamName: %s, seq: %d): %w", s.streamName, seq, err)
+	}
+	return nil
+}
+
+// FirstMessageTime returns when the oldest message in the stream was stored, or the zero time if the stream is empty.
+func (s *JetStreamMessageQueueService) FirstMessageTime(ctx context.Context) (time.Time, error) {
+	stream, err := s.js.Stream(ctx, s.streamName)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get stream (streamName: %s): %w", s.streamName, err)
+	}
+	info, err := stream.Info(ctx)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get stream info (streamName: %s): %w", s.streamName, err)
+	}
+	if info.State.Msgs == 0 {
+		return time.Time{}, nil
+	}
+	return info.State.FirstTime, nil
+}
+
+// Purge removes every message stored under the subject, which may use wildcards.
+func (s *JetStreamMessageQueueService) Purge(ctx context.Context, subject string) error {
+	stream, err := s.js.Stream(ctx, s.streamName)
+	if err != nil {
+		return fmt.Errorf("failed to get stream (streamName: %s): %w", s.streamName, err)
+	}
+	if err := stream.Purge(ctx, jetstream.WithPurgeSubject(subject)); err != nil {
+		return fmt.Errorf("failed to purge messages (streamName: %s, subject: %s): %w", s.streamName, subject, err)
+	}
+	return nil
+}
+
+// Request sends a request on a subject outside the stream and waits for the reply until the context is done.
+func (s *JetStreamMessageQueueService) Request(ctx context.Context, subject string, data []byte) ([]byte, error) {
+	msg, err := s.nc.RequestWithContext(ctx, subject, data)
+	if err != nil {
+		if errors.Is(err, nats.ErrNoResponders) {
+			return nil, fmt.Errorf("failed to send request (subject: %s): %w", subject, ErrNoResponders)
+		}
+		return nil, fmt.Errorf("failed to send request (subject: %s): %w", subject, err)
+	}
+	return msg.Data, nil
+}
+
+// Respond answers requests sent to a subject with the handler's reply until the context is done.
+func (s *JetStreamMessageQueueService) Respond(ctx context.Context, subject string, handler func(data []byte) []byte) error {
+	sub, err := s.nc.Subscribe(subject, func(msg *nats.Msg) {
+		if err := msg.Respond(handler(msg.Data)); err != nil {
+			s.log.Error("Failed to send reply", map[string]interface{}{
+				"subject": subject,
+				"error":   err.Error(),
+			})
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to requests (subject: %s): %w", subject, err)
+	}
+	s.log.Debug("Responding to requests", map[string]interface{}{
+		"subject": subject,
+	})
+
+	go func() {
+		<-ctx.Done()
+		if err := sub.Unsubscribe(); err != nil {
+			s.log.Error("Failed to unsubscribe from requests", map[string]interface{}{
+				"subject": subject,
+				"error":   err.Error(),
+			})
+		}
+	}()
+	return nil
 }
@@ -0,0 +1,716 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aligndx/aligndx/internal/logger"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// errStreamFull mirrors the error a JetStream server returns when a stream that discards new messages is full.
+var errStreamFull = errors.New("maximum messages or bytes exceeded")
+
+// defaultAckWait and defaultDuplicateWindow mirror the JetStream server defaults.
+const (
+	defaultAckWait         = 30 * time.Second
+	defaultDuplicateWindow = 2 * time.Minute
+)
+
+// MemoryBroker keeps streams in process memory. Services created from the same broker share its streams,
+// so a broker stands in for a JetStream server within a single process. Nothing survives a restart.
+type MemoryBroker struct {
+	mu         sync.Mutex
+	streams    map[string]*memoryStream
+	responders map[string][]*memoryResponder
+}
+
+type memoryResponder struct {
+	handler func(data []byte) []byte
+}
+
+// NewMemoryBroker returns an empty broker.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		streams:    make(map[string]*memoryStream),
+		responders: make(map[string][]*memoryResponder),
+	}
+}
+
+type memoryStream struct {
+	config    jetstream.StreamConfig
+	lastSeq   uint64
+	messages  []StoredMessage // Ordered by sequence
+	msgIDs    map[string]time.Time
+	consumers map[string]*memoryConsumer
+	signal    chan struct{} // Closed and replaced whenever a consumer may have something new to deliver
+}
+
+type memoryConsumer struct {
+	name          string
+	filter        string
+	ackWait       time.Duration
+	maxAckPending int
+	next          uint64   // Lowest stream sequence not yet delivered
+	backlog       []uint64 // Stored messages to deliver before continuing from next, in order
+	delivered     uint64   // Consumer sequence of the last delivery
+	pending       map[uint64]*memoryDelivery
+}
+
+type memoryDelivery struct {
+	redeliverAt time.Time
+	count       uint64
+}
+
+// MemoryMessageQueueService is a MessageQueueService backed by a stream of a MemoryBroker.
+type MemoryMessageQueueService struct {
+	broker     *MemoryBroker
+	streamName string
+	log        *logger.LoggerWrapper
+}
+
+// NewMemoryMessageQueueService creates the stream on the broker, or updates its subjects and limits if it already exists,
+// and returns a service bound to it.
+func NewMemoryMessageQueueService(broker *MemoryBroker, streamConfig jetstream.StreamConfig, log *logger.LoggerWrapper) (*MemoryMessageQueueService, error) {
+	if streamConfig.Name == "" || len(streamConfig.Subjects) == 0 {
+		return nil, fmt.Errorf("stream requires a name and at least one subject (streamName: %s)", streamConfig.Name)
+	}
+
+	broker.mu.Lock()
+	if stream, ok := broker.streams[streamConfig.Name]; ok {
+		stream.config = streamConfig
+		log.Debug("Stream updated", map[string]interface{}{
+			"streamName": streamConfig.Name,
+			"subjects":   streamConfig.Subjects,
+		})
+	} else {
+		broker.streams[streamConfig.Name] = &memoryStream{
+			config:    streamConfig,
+			msgIDs:    make(map[string]time.Time),
+			consumers: make(map[string]*memoryConsumer),
+			signal:    make(chan struct{}),
+		}
+		log.Debug("Stream created", map[string]interface{}{
+			"streamName": streamConfig.Name,
+			"subjects":   streamConfig.Subjects,
+		})
+	}
+	broker.mu.Unlock()
+
+	return &MemoryMessageQueueService{
+		broker:     broker,
+		streamName: streamConfig.Name,
+		log:        log,
+	}, nil
+}
+
+// subjectMatches reports whether a subject matches a filter that may use the * and > wildcards.
+// An empty filter matches every subject.
+func subjectMatches(filter, subject string) bool {
+	if filter == "" {
+		return true
+	}
+	filterTokens := strings.Split(filter, ".")
+	subjectTokens := strings.Split(subject, ".")
+	for i, token := range filterTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || (token != "*" && token != subjectTokens[i]) {
+			return false
+		}
+	}
+	return len(filterTokens) == len(subjectTokens)
+}
+
+// Publish stores a message on whichever stream of the broker captures the subject, as a JetStream server would.
+// A message whose ID was already published within the stream's duplicate window is dropped and is not an error.
+func (s *MemoryMessageQueueService) Publish(ctx context.Context, subject string, data []byte, opts ...PublishOption) error {
+	var o publishOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	s.broker.mu.Lock()
+	stream := s.broker.streamFor(subject)
+	if stream == nil {
+		s.broker.mu.Unlock()
+		return fmt.Errorf("failed to publish message (subject: %s): %w", subject, jetstream.ErrNoStreamResponse)
+	}
+	now := time.Now()
+	stream.prune(now)
+	if o.msgID != "" {
+		if _, ok := stream.msgIDs[o.msgID]; ok {
+			s.broker.mu.Unlock()
+			s.log.Info("Duplicate message dropped", map[string]interface{}{
+				"subject": subject,
+				"msg_id":  o.msgID,
+			})
+			return nil
+		}
+	}
+	if stream.config.Discard == jetstream.DiscardNew && stream.exceeds(1, int64(len(subject)+len(data))) {
+		s.broker.mu.Unlock()
+		return fmt.Errorf("failed to publish message (subject: %s): %w", subject, errStreamFull)
+	}
+	stream.append(StoredMessage{
+		Subject: subject,
+		Data:    append([]byte(nil), data...),
+		Time:    now,
+	})
+	// The ID only counts once the message is stored, so a rejected message can be published again.
+	if o.msgID != "" {
+		stream.msgIDs[o.msgID] = now
+	}
+	s.broker.mu.Unlock()
+
+	s.log.Debug("Message published", map[string]interface{}{
+		"subject": subject,
+	})
+	return nil
+}
+
+// streamFor returns the stream whose subjects capture the subject. The broker lock must be held.
+func (b *MemoryBroker) streamFor(subject string) *memoryStream {
+	for _, stream := range b.streams {
+		for _, filter := range stream.config.Subjects {
+			if subjectMatches(filter, subject) {
+				return stream
+			}
+		}
+	}
+	return nil
+}
+
+// stream returns the named stream. The broker lock must be held.
+func (b *MemoryBroker) stream(name string) (*memoryStream, error) {
+	stream, ok := b.streams[name]
+	if !ok {
+		return nil, fmt.Errorf("failed to get stream (streamName: %s): %w", name, jetstream.ErrStreamNotFound)
+	}
+	return stream, nil
+}
+
+// append stores a message under the next sequence, dropping the oldest messages of its subject past the per-subject limit
+// and the oldest messages of the stream past its message and byte limits.
+func (st *memoryStream) append(msg StoredMessage) {
+	st.lastSeq++
+	msg.Sequence = st.lastSeq
+	st.messages = append(st.messages, msg)
+	for len(st.messages) > 1 && st.exceeds(0, 0) {
+		st.remove(st.messages[0].Sequence)
+	}
+
+	if limit := st.config.MaxMsgsPerSubject; limit > 0 {
+		var kept int64
+		for i := len(st.messages) - 1; i >= 0; i-- {
+			if st.messages[i].Subject != msg.Subject {
+				continue
+			}
+			if kept++; kept > limit {
+				st.remove(st.messages[i].Sequence)
+			}
+		}
+	}
+	st.notify()
+}
+
+// exceeds reports whether the stream would be past its message or byte limit after storing msgs more messages
+// and bytes more bytes. Limits of zero or less are unlimited.
+func (st *memoryStream) exceeds(msgs, bytes int64) bool {
+	if limit := st.config.MaxMsgs; limit > 0 && int64(len(st.messages))+msgs > limit {
+		return true
+	}
+	if limit := st.config.MaxBytes; limit > 0 {
+		size := bytes
+		for _, msg := range st.messages {
+			size += int64(len(msg.Subject) + len(msg.Data))
+		}
+		return size > limit
+	}
+	return false
+}
+
+// prune drops messages older than the stream's max age and message IDs older than its duplicate window.
+func (st *memoryStream) prune(now time.Time) {
+	if maxAge := st.config.MaxAge; maxAge > 0 {
+		cutoff := now.Add(-maxAge)
+		i := sort.Search(len(st.messages), func(i int) bool { return st.messages[i].Time.After(cutoff) })
+		st.messages = st.messages[i:]
+	}
+	window := st.config.Duplicates
+	if window <= 0 {
+		window = defaultDuplicateWindow
+	}
+	for id, published := range st.msgIDs {
+		if now.Sub(published) > window {
+			delete(st.msgIDs, id)
+		}
+	}
+}
+
+// find returns the index of the message with the given sequence.
+func (st *memoryStream) find(seq uint64) (int, bool) {
+	i := sort.Search(len(st.messages), func(i int) bool { return st.messages[i].Sequence >= seq })
+	return i, i < len(st.messages) && st.messages[i].Sequence == seq
+}
+
+// remove deletes the message with the given sequence, reporting whether it was stored.
+func (st *memoryStream) remove(seq uint64) bool {
+	i, ok := st.find(seq)
+	if ok {
+		st.messages = append(st.messages[:i], st.messages[i+1:]...)
+	}
+	return ok
+}
+
+// notify wakes every consumer waiting on the stream.
+func (st *memoryStream) notify() {
+	close(st.signal)
+	st.signal = make(chan struct{})
+}
+
+// consumer returns the durable consumer for a configuration, creating it on first use.
+// A configuration without a durable name yields a new ephemeral consumer that is not kept on the stream.
+func (st *memoryStream) consumer(consumerConfig jetstream.ConsumerConfig) *memoryConsumer {
+	ackWait := consumerConfig.AckWait
+	if ackWait <= 0 {
+		ackWait = defaultAckWait
+	}
+	if cons, ok := st.consumers[consumerConfig.Durable]; ok && consumerConfig.Durable != "" {
+		cons.filter = consumerConfig.FilterSubject
+		cons.ackWait = ackWait
+		cons.maxAckPending = consumerConfig.MaxAckPending
+		return cons
+	}
+
+	cons := &memoryConsumer{
+		name:          consumerConfig.Durable,
+		filter:        consumerConfig.FilterSubject,
+		ackWait:       ackWait,
+		maxAckPending: consumerConfig.MaxAckPending,
+		next:          1,
+		pending:       make(map[uint64]*memoryDelivery),
+	}
+	switch consumerConfig.DeliverPolicy {
+	case jetstream.DeliverNewPolicy:
+		cons.next = st.lastSeq + 1
+	case jetstream.DeliverByStartSequencePolicy:
+		cons.next = max(consumerConfig.OptStartSeq, 1)
+	case jetstream.DeliverByStartTimePolicy:
+		cons.next = st.lastSeq + 1
+		if consumerConfig.OptStartTime != nil {
+			i := sort.Search(len(st.messages), func(i int) bool { return !st.messages[i].Time.Before(*consumerConfig.OptStartTime) })
+			if i < len(st.messages) {
+				cons.next = st.messages[i].Sequence
+			}
+		}
+	case jetstream.DeliverLastPerSubjectPolicy:
+		cons.next = st.lastSeq + 1
+		seen := make(map[string]bool)
+		for i := len(st.messages) - 1; i >= 0; i-- {
+			msg := st.messages[i]
+			if !seen[msg.Subject] && subjectMatches(cons.filter, msg.Subject) {
+				seen[msg.Subject] = true
+				cons.backlog = append(cons.backlog, msg.Sequence)
+			}
+		}
+		slices.Reverse(cons.backlog)
+	}
+	if cons.name != "" {
+		st.consumers[cons.name] = cons
+	}
+	return cons
+}
+
+// next returns the next message for the consumer: an expired or naked delivery first, then its backlog,
+// then the oldest undelivered message matching its filter. When there is none, it returns how long until a pending delivery expires (zero if none will).
+// The broker lock must be held.
+func (s *MemoryMessageQueueService) next(stream *memoryStream, cons *memoryConsumer, now time.Time) (*memoryMsg, time.Duration) {
+	var redeliver uint64
+	var wait time.Duration
+	for seq, delivery := range cons.pending {
+		if _, ok := stream.find(seq); !ok {
+			delete(cons.pending, seq)
+			continue
+		}
+		if until := delivery.redeliverAt.Sub(now); until > 0 {
+			if wait == 0 || until < wait {
+				wait = until
+			}
+			continue
+		}
+		if redeliver == 0 || seq < redeliver {
+			redeliver = seq
+		}
+	}
+	if redeliver != 0 {
+		return s.deliver(stream, cons, redeliver, now), 0
+	}
+
+	if cons.maxAckPending > 0 && len(cons.pending) >= cons.maxAckPending {
+		return nil, wait
+	}
+	for len(cons.backlog) > 0 {
+		seq := cons.backlog[0]
+		cons.backlog = cons.backlog[1:]
+		if _, ok := stream.find(seq); ok {
+			cons.pending[seq] = &memoryDelivery{}
+			return s.deliver(stream, cons, seq, now), 0
+		}
+	}
+	start, _ := stream.find(cons.next)
+	for _, msg := range stream.messages[start:] {
+		cons.next = msg.Sequence + 1
+		if subjectMatches(cons.filter, msg.Subject) {
+			cons.pending[msg.Sequence] = &memoryDelivery{}
+			return s.deliver(stream, cons, msg.Sequence, now), 0
+		}
+	}
+	return nil, wait
+}
+
+// deliver records a delivery of a pending message and wraps it for the handler. Every delivery gets its own
+// state, so settling an earlier delivery of the message cannot settle this one. The broker lock must be held.
+func (s *MemoryMessageQueueService) deliver(stream *memoryStream, cons *memoryConsumer, seq uint64, now time.Time) *memoryMsg {
+	delivery := &memoryDelivery{
+		redeliverAt: now.Add(cons.ackWait),
+		count:       cons.pending[seq].count + 1,
+	}
+	cons.pending[seq] = delivery
+	cons.delivered++
+
+	i, _ := stream.find(seq)
+	return &memoryMsg{
+		service:  s,
+		stream:   stream,
+		consumer: cons,
+		stored:   stream.messages[i],
+		delivery: delivery,
+		meta: jetstream.MsgMetadata{
+			Sequence:     jetstream.SequencePair{Consumer: cons.delivered, Stream: seq},
+			NumDelivered: delivery.count,
+			Timestamp:    stream.messages[i].Time,
+			Stream:       stream.config.Name,
+			Consumer:     cons.name,
+		},
+	}
+}
+
+// SubscribeWithConfig subscribes using a provided consumer configuration.
+// Messages are acknowledged once the handler returns.
+func (s *MemoryMessageQueueService) SubscribeWithConfig(ctx context.Context, consumerConfig jetstream.ConsumerConfig, handler func(jetstream.Msg)) error {
+	return s.ConsumeWithConfig(ctx, consumerConfig, func(msg jetstream.Msg) {
+		handler(msg)
+		if ackErr := msg.Ack(); ackErr != nil {
+			s.log.Error("Failed to acknowledge message", map[string]interface{}{
+				"error": ackErr.Error(),
+			})
+		} else {
+			s.log.Debug("Message acknowledged", nil)
+		}
+	})
+}
+
+// ConsumeWithConfig consumes using a provided consumer configuration until the context is done.
+// Messages are not acknowledged; the handler is responsible for acking, naking or terminating them.
+func (s *MemoryMessageQueueService) ConsumeWithConfig(ctx context.Context, consumerConfig jetstream.ConsumerConfig, handler func(jetstream.Msg)) error {
+	s.broker.mu.Lock()
+	stream, err := s.broker.stream(s.streamName)
+	if err != nil {
+		s.broker.mu.Unlock()
+		return err
+	}
+	cons := stream.consumer(consumerConfig)
+	s.broker.mu.Unlock()
+	s.log.Debug("Consumer created or updated", map[string]interface{}{
+		"streamName":   s.streamName,
+		"consumerName": consumerConfig.Durable,
+	})
+
+	go func() {
+		for {
+			s.broker.mu.Lock()
+			msg, wait := s.next(stream, cons, time.Now())
+			signal := stream.signal
+			s.broker.mu.Unlock()
+
+			if msg != nil {
+				s.log.Debug("Message received", map[string]interface{}{
+					"streamName": s.streamName,
+					"subject":    msg.Subject(),
+					"data":       string(msg.Data()),
+				})
+				handler(msg)
+				continue
+			}
+
+			var timer *time.Timer
+			var timeout <-chan time.Time
+			if wait > 0 {
+				timer = time.NewTimer(wait)
+				timeout = timer.C
+			}
+			select {
+			case <-ctx.Done():
+				s.log.Debug("Context cancelled, stopping consumer", nil)
+				return
+			case <-signal:
+			case <-timeout:
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+	}()
+	return nil
+}
+
+// Subscribe implements the MessageQueueService interface.
+// It constructs a consumer config from the given subject, consumerName and options and then calls SubscribeWithConfig.
+// An empty consumerName subscribes through an ephemeral consumer.
+func (s *MemoryMessageQueueService) Subscribe(ctx context.Context, subject string, consumerName string, handler func(jetstream.Msg), opts ...SubscribeOption) error {
+	return s.SubscribeWithConfig(ctx, newConsumerConfig(subject, consumerName, opts), handler)
+}
+
+// Fetch implements the MessageQueueService interface.
+// It returns up to batch messages that are available right now from a durable consumer with the given limits,
+// without waiting for new ones. Acknowledgement is left to the caller.
+func (s *MemoryMessageQueueService) Fetch(ctx context.Context, subject string, consumerName string, limits ConsumerLimits, batch int) ([]jetstream.Msg, error) {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	stream, err := s.broker.stream(s.streamName)
+	if err != nil {
+		return nil, err
+	}
+	cons := stream.consumer(jetstream.ConsumerConfig{
+		Durable:       consumerName,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		DeliverPolicy: jetstream.DeliverAllPolicy,
+		FilterSubject: subject,
+		AckWait:       limits.AckWait,
+		MaxAckPending: limits.MaxAckPending,
+	})
+
+	now := time.Now()
+	var msgs []jetstream.Msg
+	for len(msgs) < batch {
+		msg, _ := s.next(stream, cons, now)
+		if msg == nil {
+			break
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// LastMessage returns the most recent message stored on the given subject.
+func (s *MemoryMessageQueueService) LastMessage(ctx context.Context, subject string) (*StoredMessage, error) {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	stream, err := s.broker.stream(s.streamName)
+	if err != nil {
+		return nil, err
+	}
+	stream.prune(time.Now())
+	for i := len(stream.messages) - 1; i >= 0; i-- {
+		if subjectMatches(subject, stream.messages[i].Subject) {
+			msg := stream.messages[i]
+			return &msg, nil
+		}
+	}
+	return nil, ErrMessageNotFound
+}
+
+// LastMessages returns the most recent message of every subject matching the filter, ordered by sequence.
+func (s *MemoryMessageQueueService) LastMessages(ctx context.Context, filter string) ([]StoredMessage, error) {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	stream, err := s.broker.stream(s.streamName)
+	if err != nil {
+		return nil, err
+	}
+	stream.prune(time.Now())
+	seen := make(map[string]bool)
+	var messages []StoredMessage
+	for i := len(stream.messages) - 1; i >= 0; i-- {
+		msg := stream.messages[i]
+		if seen[msg.Subject] || !subjectMatches(filter, msg.Subject) {
+			continue
+		}
+		seen[msg.Subject] = true
+		messages = append(messages, msg)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Sequence < messages[j].Sequence })
+	return messages, nil
+}
+
+// DeleteMessage removes the message with the given sequence from the stream.
+func (s *MemoryMessageQueueService) DeleteMessage(ctx context.Context, seq uint64) error {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	stream, err := s.broker.stream(s.streamName)
+	if err != nil {
+		return err
+	}
+	if !stream.remove(seq) {
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+// FirstMessageTime returns when the oldest message in the stream was stored, or the zero time if the stream is empty.
+func (s *MemoryMessageQueueService) FirstMessageTime(ctx context.Context) (time.Time, error) {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	stream, err := s.broker.stream(s.streamName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	stream.prune(time.Now())
+	if len(stream.messages) == 0 {
+		return time.Time{}, nil
+	}
+	return stream.messages[0].Time, nil
+}
+
+// Purge removes every message stored under the subject, which may use wildcards.
+func (s *MemoryMessageQueueService) Purge(ctx context.Context, subject string) error {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	stream, err := s.broker.stream(s.streamName)
+	if err != nil {
+		return err
+	}
+	stream.messages = slices.DeleteFunc(stream.messages, func(msg StoredMessage) bool {
+		return subjectMatches(subject, msg.Subject)
+	})
+	return nil
+}
+
+// Request sends a request to the first responder of the subject and returns its reply.
+func (s *MemoryMessageQueueService) Request(ctx context.Context, subject string, data []byte) ([]byte, error) {
+	s.broker.mu.Lock()
+	var responder *memoryResponder
+	if responders := s.broker.responders[subject]; len(responders) > 0 {
+		responder = responders[0]
+	}
+	s.broker.mu.Unlock()
+	if responder == nil {
+		return nil, fmt.Errorf("failed to send request (subject: %s): %w", subject, ErrNoResponders)
+	}
+
+	reply := make(chan []byte, 1)
+	go func() { reply <- responder.handler(append([]byte(nil), data...)) }()
+	select {
+	case data := <-reply:
+		return data, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to send request (subject: %s): %w", subject, ctx.Err())
+	}
+}
+
+// Respond answers requests sent to a subject with the handler's reply until the context is done.
+func (s *MemoryMessageQueueService) Respond(ctx context.Context, subject string, handler func(data []byte) []byte) error {
+	responder := &memoryResponder{handler: handler}
+	s.broker.mu.Lock()
+	s.broker.responders[subject] = append(s.broker.responders[subject], responder)
+	s.broker.mu.Unlock()
+	s.log.Debug("Responding to requests", map[string]interface{}{
+		"subject": subject,
+	})
+
+	go func() {
+		<-ctx.Done()
+		s.broker.mu.Lock()
+		defer s.broker.mu.Unlock()
+		s.broker.responders[subject] = slices.DeleteFunc(s.broker.responders[subject], func(r *memoryResponder) bool { return r == responder })
+		if len(s.broker.responders[subject]) == 0 {
+			delete(s.broker.responders, subject)
+		}
+	}()
+	return nil
+}
+
+// memoryMsg is a message delivered by a MemoryMessageQueueService consumer.
+type memoryMsg struct {
+	service  *MemoryMessageQueueService
+	stream   *memoryStream
+	consumer *memoryConsumer
+	stored   StoredMessage
+	delivery *memoryDelivery
+	meta     jetstream.MsgMetadata
+	done     bool // Guarded by the broker lock
+}
+
+func (m *memoryMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	meta := m.meta
+	return &meta, nil
+}
+
+func (m *memoryMsg) Data() []byte         { return m.stored.Data }
+func (m *memoryMsg) Headers() nats.Header { return nil }
+func (m *memoryMsg) Subject() string      { return m.stored.Subject }
+func (m *memoryMsg) Reply() string        { return "" }
+
+// settle ends this delivery of the message. If the consumer has since redelivered it, settling is a no-op.
+func (m *memoryMsg) settle(fn func()) error {
+	m.service.broker.mu.Lock()
+	defer m.service.broker.mu.Unlock()
+	if m.done {
+		return jetstream.ErrMsgAlreadyAckd
+	}
+	m.done = true
+	if m.current() {
+		fn()
+		m.stream.notify()
+	}
+	return nil
+}
+
+// current reports whether this is the latest delivery of a message the consumer still has pending.
+// The broker lock must be held.
+func (m *memoryMsg) current() bool {
+	return m.consumer.pending[m.stored.Sequence] == m.delivery
+}
+
+// finish removes the message from the consumer, and from the stream under work-queue retention.
+func (m *memoryMsg) finish() {
+	delete(m.consumer.pending, m.stored.Sequence)
+	if m.stream.config.Retention == jetstream.WorkQueuePolicy {
+		m.stream.remove(m.stored.Sequence)
+	}
+}
+
+func (m *memoryMsg) Ack() error { return m.settle(m.finish) }
+
+func (m *memoryMsg) DoubleAck(ctx context.Context) error { return m.Ack() }
+
+func (m *memoryMsg) Nak() error { return m.NakWithDelay(0) }
+
+func (m *memoryMsg) NakWithDelay(delay time.Duration) error {
+	return m.settle(func() { m.delivery.redeliverAt = time.Now().Add(delay) })
+}
+
+func (m *memoryMsg) InProgress() error {
+	m.service.broker.mu.Lock()
+	defer m.service.broker.mu.Unlock()
+	if m.done {
+		return jetstream.ErrMsgAlreadyAckd
+	}
+	if m.current() {
+		m.delivery.redeliverAt = time.Now().Add(m.consumer.ackWait)
+	}
+	return nil
+}
+
+func (m *memoryMsg) Term() error { return m.settle(m.finish) }
+
+func (m *memoryMsg) TermWithReason(reason string) error { return m.Term() }
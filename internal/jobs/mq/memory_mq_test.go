@@ -0,0 +1,219 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aligndx/aligndx/internal/logger"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// newTestService returns a service bound to a new stream on its own broker.
+func newTestService(t *testing.T, streamConfig jetstream.StreamConfig) *MemoryMessageQueueService {
+	t.Helper()
+	if streamConfig.Name == "" {
+		streamConfig.Name = "TEST"
+	}
+	if len(streamConfig.Subjects) == 0 {
+		streamConfig.Subjects = []string{"test.>"}
+	}
+	s, err := NewMemoryMessageQueueService(NewMemoryBroker(), streamConfig, logger.NewLoggerWrapper("test", context.Background()))
+	if err != nil {
+		t.Fatalf("NewMemoryMessageQueueService: %v", err)
+	}
+	return s
+}
+
+// fetchOne fetches a single message, failing the test if none is available.
+func fetchOne(t *testing.T, s *MemoryMessageQueueService, limits ConsumerLimits) jetstream.Msg {
+	t.Helper()
+	msgs, err := s.Fetch(context.Background(), "test.>", "worker", limits, 1)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("Fetch returned %d messages, want 1", len(msgs))
+	}
+	return msgs[0]
+}
+
+// fetchNone fails the test if a message is available.
+func fetchNone(t *testing.T, s *MemoryMessageQueueService, limits ConsumerLimits) {
+	t.Helper()
+	msgs, err := s.Fetch(context.Background(), "test.>", "worker", limits, 1)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if len(msgs) != 0 {
+		t.Fatalf("Fetch returned %d messages, want none", len(msgs))
+	}
+}
+
+func publish(t *testing.T, s *MemoryMessageQueueService, subject, data string, opts ...PublishOption) {
+	t.Helper()
+	if err := s.Publish(context.Background(), subject, []byte(data), opts...); err != nil {
+		t.Fatalf("Publish(%s): %v", subject, err)
+	}
+}
+
+func TestMemoryWorkQueueAckRemovesMessage(t *testing.T) {
+	s := newTestService(t, jetstream.StreamConfig{Retention: jetstream.WorkQueuePolicy})
+	limits := ConsumerLimits{AckWait: time.Minute}
+	publish(t, s, "test.a", "job")
+
+	msg := fetchOne(t, s, limits)
+	if err := msg.Ack(); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if _, err := s.LastMessage(context.Background(), "test.a"); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("LastMessage after ack = %v, want ErrMessageNotFound", err)
+	}
+	fetchNone(t, s, limits)
+	if err := msg.Ack(); !errors.Is(err, jetstream.ErrMsgAlreadyAckd) {
+		t.Fatalf("second Ack = %v, want ErrMsgAlreadyAckd", err)
+	}
+}
+
+func TestMemoryRedeliveryAfterAckWait(t *testing.T) {
+	s := newTestService(t, jetstream.StreamConfig{Retention: jetstream.WorkQueuePolicy})
+	limits := ConsumerLimits{AckWait: 20 * time.Millisecond}
+	publish(t, s, "test.a", "job")
+
+	first := fetchOne(t, s, limits)
+	fetchNone(t, s, limits)
+	time.Sleep(30 * time.Millisecond)
+
+	second := fetchOne(t, s, limits)
+	meta, err := second.Metadata()
+	if err != nil {
+		t.Fatalf("Metadata: %v", err)
+	}
+	if meta.NumDelivered != 2 {
+		t.Fatalf("NumDelivered = %d, want 2", meta.NumDelivered)
+	}
+
+	// Settling the expired delivery must not settle the redelivery.
+	if err := first.Ack(); err != nil {
+		t.Fatalf("Ack of expired delivery: %v", err)
+	}
+	if _, err := s.LastMessage(context.Background(), "test.a"); err != nil {
+		t.Fatalf("message removed by a stale ack: %v", err)
+	}
+	if err := second.Ack(); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if _, err := s.LastMessage(context.Background(), "test.a"); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("LastMessage after ack = %v, want ErrMessageNotFound", err)
+	}
+}
+
+func TestMemoryNakWithDelay(t *testing.T) {
+	s := newTestService(t, jetstream.StreamConfig{Retention: jetstream.WorkQueuePolicy})
+	limits := ConsumerLimits{AckWait: time.Minute}
+	publish(t, s, "test.a", "job")
+
+	if err := fetchOne(t, s, limits).NakWithDelay(30 * time.Millisecond); err != nil {
+		t.Fatalf("NakWithDelay: %v", err)
+	}
+	fetchNone(t, s, limits)
+	time.Sleep(40 * time.Millisecond)
+
+	msg := fetchOne(t, s, limits)
+	if err := msg.Nak(); err != nil {
+		t.Fatalf("Nak: %v", err)
+	}
+	msg = fetchOne(t, s, limits)
+	if meta, _ := msg.Metadata(); meta.NumDelivered != 3 {
+		t.Fatalf("NumDelivered = %d, want 3", meta.NumDelivered)
+	}
+}
+
+func TestMemoryDuplicateMessageDropped(t *testing.T) {
+	s := newTestService(t, jetstream.StreamConfig{Duplicates: time.Minute})
+	publish(t, s, "test.a", "first", WithMsgID("id"))
+	publish(t, s, "test.a", "second", WithMsgID("id"))
+	publish(t, s, "test.a", "third", WithMsgID("other"))
+
+	msgs, err := s.LastMessages(context.Background(), "test.>")
+	if err != nil {
+		t.Fatalf("LastMessages: %v", err)
+	}
+	if len(msgs) != 1 || string(msgs[0].Data) != "third" || msgs[0].Sequence != 2 {
+		t.Fatalf("LastMessages = %+v, want only the third message at sequence 2", msgs)
+	}
+}
+
+func TestMemoryDiscardNewRejectsWhenFull(t *testing.T) {
+	s := newTestService(t, jetstream.StreamConfig{MaxMsgs: 2, Discard: jetstream.DiscardNew})
+	publish(t, s, "test.a", "1")
+	publish(t, s, "test.a", "2", WithMsgID("two"))
+
+	err := s.Publish(context.Background(), "test.a", []byte("3"), WithMsgID("three"))
+	if err == nil {
+		t.Fatal("Publish to a full stream succeeded")
+	}
+	msgs, _ := s.LastMessages(context.Background(), "test.>")
+	if len(msgs) != 1 || string(msgs[0].Data) != "2" {
+		t.Fatalf("LastMessages = %+v, want the second message", msgs)
+	}
+
+	// A rejected message is not a duplicate once there is room.
+	if err := s.DeleteMessage(context.Background(), 1); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	publish(t, s, "test.a", "3", WithMsgID("three"))
+	if last, _ := s.LastMessage(context.Background(), "test.a"); string(last.Data) != "3" {
+		t.Fatalf("LastMessage = %q, want 3", last.Data)
+	}
+}
+
+func TestMemoryDiscardOldDropsOldest(t *testing.T) {
+	s := newTestService(t, jetstream.StreamConfig{MaxMsgs: 2})
+	for _, data := range []string{"1", "2", "3"} {
+		publish(t, s, "test."+data, data)
+	}
+	msgs, _ := s.LastMessages(context.Background(), "test.>")
+	if len(msgs) != 2 || string(msgs[0].Data) != "2" || string(msgs[1].Data) != "3" {
+		t.Fatalf("LastMessages = %+v, want messages 2 and 3", msgs)
+	}
+}
+
+func TestMemoryLastMessages(t *testing.T) {
+	s := newTestService(t, jetstream.StreamConfig{})
+	publish(t, s, "test.a", "a1")
+	publish(t, s, "test.b", "b1")
+	publish(t, s, "test.a", "a2")
+
+	last, err := s.LastMessage(context.Background(), "test.a")
+	if err != nil || string(last.Data) != "a2" {
+		t.Fatalf("LastMessage(test.a) = %v, %v; want a2", last, err)
+	}
+	if _, err := s.LastMessage(context.Background(), "test.missing"); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("LastMessage(test.missing) = %v, want ErrMessageNotFound", err)
+	}
+
+	msgs, err := s.LastMessages(context.Background(), "test.*")
+	if err != nil {
+		t.Fatalf("LastMessages: %v", err)
+	}
+	var got []string
+	for _, msg := range msgs {
+		got = append(got, string(msg.Data))
+	}
+	if len(got) != 2 || got[0] != "b1" || got[1] != "a2" {
+		t.Fatalf("LastMessages = %v, want [b1 a2] in sequence order", got)
+	}
+}
+
+func TestMemoryMaxMsgsPerSubject(t *testing.T) {
+	s := newTestService(t, jetstream.StreamConfig{MaxMsgsPerSubject: 1})
+	publish(t, s, "test.a", "a1")
+	publish(t, s, "test.a", "a2")
+	publish(t, s, "test.b", "b1")
+
+	if err := s.DeleteMessage(context.Background(), 1); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("DeleteMessage(1) = %v, want ErrMessageNotFound as the per-subject limit dropped it", err)
+	}
+}
@@ -0,0 +1,176 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aligndx/aligndx/internal/config"
+	"github.com/aligndx/aligndx/internal/logger"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ErrStreamMigration is returned when an existing stream differs from its configuration in a way
+// that cannot be applied in place.
+var ErrStreamMigration = errors.New("stream needs a manual migration")
+
+// ConfigureStream applies the configured settings of a stream to its fixed shape: name, subjects and retention.
+func ConfigureStream(base jetstream.StreamConfig, settings config.StreamConfig) (jetstream.StreamConfig, error) {
+	streamConfig := base
+	streamConfig.MaxAge = settings.MaxAge
+	streamConfig.MaxBytes = settings.MaxBytes
+	streamConfig.MaxMsgs = settings.MaxMsgs
+	streamConfig.Replicas = settings.Replicas
+
+	switch strings.ToLower(settings.Storage) {
+	case "", "file":
+		streamConfig.Storage = jetstream.FileStorage
+	case "memory":
+		streamConfig.Storage = jetstream.MemoryStorage
+	default:
+		return streamConfig, fmt.Errorf("unknown storage for stream %s: %q (expected file or memory)", base.Name, settings.Storage)
+	}
+	switch strings.ToLower(settings.Discard) {
+	case "", "old":
+		streamConfig.Discard = jetstream.DiscardOld
+	case "new":
+		streamConfig.Discard = jetstream.DiscardNew
+	default:
+		return streamConfig, fmt.Errorf("unknown discard policy for stream %s: %q (expected old or new)", base.Name, settings.Discard)
+	}
+	return normalizeStream(streamConfig), nil
+}
+
+// normalizeStream fills in the values the server uses for unset limits, so a configuration can be compared with a live stream.
+func normalizeStream(c jetstream.StreamConfig) jetstream.StreamConfig {
+	for _, limit := range []*int64{&c.MaxBytes, &c.MaxMsgs, &c.MaxMsgsPerSubject} {
+		if *limit <= 0 {
+			*limit = -1
+		}
+	}
+	if c.Replicas <= 0 {
+		c.Replicas = 1
+	}
+	return c
+}
+
+// streamChange is a difference between a live stream and its configuration.
+type streamChange struct {
+	field    string
+	from, to string
+	apply    func(*jetstream.StreamConfig)
+	unsafe   string // Why the change cannot be applied in place, if it cannot
+}
+
+func (c streamChange) String() string {
+	return fmt.Sprintf("%s %s -> %s", c.field, c.from, c.to)
+}
+
+// streamChanges lists how the configuration differs from the live stream. Settings the configuration leaves
+// to the server, such as the duplicate window when it is unset, are not compared.
+func streamChanges(current, desired jetstream.StreamConfig) []streamChange {
+	var changes []streamChange
+	add := func(field string, from, to any, apply func(*jetstream.StreamConfig)) *streamChange {
+		changes = append(changes, streamChange{field: field, from: fmt.Sprint(from), to: fmt.Sprint(to), apply: apply})
+		return &changes[len(changes)-1]
+	}
+	workQueue := current.Retention == jetstream.WorkQueuePolicy
+
+	if current.Retention != desired.Retention {
+		add("retention", current.Retention, desired.Retention, nil).unsafe = "retention cannot be changed on an existing stream"
+	}
+	if current.Storage != desired.Storage {
+		add("storage", current.Storage, desired.Storage, nil).unsafe = "storage cannot be changed on an existing stream"
+	}
+	if !slices.Equal(current.Subjects, desired.Subjects) {
+		change := add("subjects", current.Subjects, desired.Subjects, func(c *jetstream.StreamConfig) { c.Subjects = desired.Subjects })
+		if workQueue && slices.ContainsFunc(current.Subjects, func(subject string) bool { return !slices.Contains(desired.Subjects, subject) }) {
+			change.unsafe = "removing a subject would strand the jobs queued on it"
+		}
+	}
+	if desired.Duplicates > 0 && current.Duplicates != desired.Duplicates {
+		add("duplicates", current.Duplicates, desired.Duplicates, func(c *jetstream.StreamConfig) { c.Duplicates = desired.Duplicates })
+	}
+	if current.MaxAge != desired.MaxAge {
+		change := add("max_age", current.MaxAge, desired.MaxAge, func(c *jetstream.StreamConfig) { c.MaxAge = desired.MaxAge })
+		if workQueue && tightens(int64(current.MaxAge), int64(desired.MaxAge)) {
+			change.unsafe = "a shorter max age would discard queued jobs"
+		}
+	}
+	limits := []struct {
+		field            string
+		current, desired int64
+		apply            func(*jetstream.StreamConfig)
+	}{
+		{"max_bytes", current.MaxBytes, desired.MaxBytes, func(c *jetstream.StreamConfig) { c.MaxBytes = desired.MaxBytes }},
+		{"max_msgs", current.MaxMsgs, desired.MaxMsgs, func(c *jetstream.StreamConfig) { c.MaxMsgs = desired.MaxMsgs }},
+		{"max_msgs_per_subject", current.MaxMsgsPerSubject, desired.MaxMsgsPerSubject, func(c *jetstream.StreamConfig) { c.MaxMsgsPerSubject = desired.MaxMsgsPerSubject }},
+	}
+	for _, limit := range limits {
+		if limit.current == limit.desired {
+			continue
+		}
+		change := add(limit.field, limit.current, limit.desired, limit.apply)
+		if workQueue && tightens(limit.current, limit.desired) {
+			change.unsafe = "a lower limit would discard queued jobs"
+		}
+	}
+	if current.Discard != desired.Discard {
+		add("discard", current.Discard, desired.Discard, func(c *jetstream.StreamConfig) { c.Discard = desired.Discard })
+	}
+	if current.Replicas != desired.Replicas {
+		add("replicas", current.Replicas, desired.Replicas, func(c *jetstream.StreamConfig) { c.Replicas = desired.Replicas })
+	}
+	return changes
+}
+
+// tightens reports whether a limit goes down, where zero or less means no limit.
+func tightens(current, desired int64) bool {
+	return desired > 0 && (current <= 0 || desired < current)
+}
+
+// reconcileStream applies the configuration to an existing stream. Changes that are safe are applied in place;
+// if any change is not, nothing is applied and an ErrStreamMigration error explains what needs migrating.
+func reconcileStream(ctx context.Context, js jetstream.JetStream, desired jetstream.StreamConfig, log *logger.LoggerWrapper) error {
+	stream, err := js.Stream(ctx, desired.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get stream (streamName: %s): %w", desired.Name, err)
+	}
+	current := stream.CachedInfo().Config
+	changes := streamChanges(normalizeStream(current), normalizeStream(desired))
+	if len(changes) == 0 {
+		return nil
+	}
+
+	var unsafe []string
+	for _, change := range changes {
+		if change.unsafe != "" {
+			unsafe = append(unsafe, fmt.Sprintf("%s (%s)", change, change.unsafe))
+		}
+	}
+	if len(unsafe) > 0 {
+		log.Error("Stream configuration cannot be applied", map[string]interface{}{
+			"streamName": desired.Name,
+			"changes":    unsafe,
+		})
+		return fmt.Errorf("%w (streamName: %s): %s; back up and delete the stream (nats stream rm %s) so it is recreated, or revert the configuration",
+			ErrStreamMigration, desired.Name, strings.Join(unsafe, "; "), desired.Name)
+	}
+
+	updated := current
+	applied := make([]string, 0, len(changes))
+	for _, change := range changes {
+		change.apply(&updated)
+		applied = append(applied, change.String())
+	}
+	if _, err := js.UpdateStream(ctx, updated); err != nil {
+		return fmt.Errorf("failed to update stream (streamName: %s, changes: %v): %w", desired.Name, applied, err)
+	}
+	log.Info("Stream updated", map[string]interface{}{
+		"streamName": desired.Name,
+		"changes":    applied,
+	})
+	return nil
+}
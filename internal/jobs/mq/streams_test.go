@@ -0,0 +1,35 @@
+package mq
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestStreamSubjectChanges(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention jetstream.RetentionPolicy
+		from, to  []string
+		unsafe    bool
+	}{
+		{"subject added to a work queue", jetstream.WorkQueuePolicy, []string{"jobs.request"}, []string{"jobs.request.*", "jobs.request"}, false},
+		{"subject removed from a work queue", jetstream.WorkQueuePolicy, []string{"jobs.request"}, []string{"jobs.request.*"}, true},
+		{"subject removed from a limits stream", jetstream.LimitsPolicy, []string{"jobs.events"}, []string{"jobs.events.>"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := normalizeStream(jetstream.StreamConfig{Retention: tt.retention, Subjects: tt.from})
+			desired := current
+			desired.Subjects = tt.to
+
+			changes := streamChanges(current, desired)
+			if len(changes) != 1 || changes[0].field != "subjects" {
+				t.Fatalf("changes = %v, want a subjects change", changes)
+			}
+			if unsafe := changes[0].unsafe != ""; unsafe != tt.unsafe {
+				t.Fatalf("unsafe = %v (%q), want %v", unsafe, changes[0].unsafe, tt.unsafe)
+			}
+		})
+	}
+}
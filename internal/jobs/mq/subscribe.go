@@ -0,0 +1,59 @@
+package mq
+
+import (
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// SubscribeOption sets where a subscription starts reading its stream. Options only take effect when
+// the consumer is created; an existing durable consumer resumes where it left off.
+type SubscribeOption func(*jetstream.ConsumerConfig)
+
+// DeliverAll starts at the first message stored on the stream. It is the default.
+func DeliverAll() SubscribeOption {
+	return deliverFrom(jetstream.DeliverAllPolicy, 0, nil)
+}
+
+// DeliverNew starts with the first message published after the subscription is created.
+func DeliverNew() SubscribeOption {
+	return deliverFrom(jetstream.DeliverNewPolicy, 0, nil)
+}
+
+// StartAtSequence starts at the message with the given stream sequence, or the first one after it.
+func StartAtSequence(seq uint64) SubscribeOption {
+	return deliverFrom(jetstream.DeliverByStartSequencePolicy, seq, nil)
+}
+
+// StartAtTime starts at the first message stored at or after the given time.
+func StartAtTime(t time.Time) SubscribeOption {
+	return deliverFrom(jetstream.DeliverByStartTimePolicy, 0, &t)
+}
+
+// DeliverLastPerSubject starts with the latest message of every matching subject, then continues with new ones.
+func DeliverLastPerSubject() SubscribeOption {
+	return deliverFrom(jetstream.DeliverLastPerSubjectPolicy, 0, nil)
+}
+
+func deliverFrom(policy jetstream.DeliverPolicy, seq uint64, t *time.Time) SubscribeOption {
+	return func(c *jetstream.ConsumerConfig) {
+		c.DeliverPolicy = policy
+		c.OptStartSeq = seq
+		c.OptStartTime = t
+	}
+}
+
+// newConsumerConfig builds the configuration of a consumer reading the subject from the start of the stream,
+// adjusted by the options. An empty consumer name makes the consumer ephemeral.
+func newConsumerConfig(subject string, consumerName string, opts []SubscribeOption) jetstream.ConsumerConfig {
+	config := jetstream.ConsumerConfig{
+		Durable:       consumerName,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		DeliverPolicy: jetstream.DeliverAllPolicy,
+		FilterSubject: subject,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
@@ -0,0 +1,124 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aligndx/aligndx/internal/jobs/mq"
+)
+
+// Priority is the work-queue lane a job is published to.
+type Priority string
+
+const (
+	PriorityUrgent Priority = "urgent"
+	PriorityNormal Priority = "normal"
+	PriorityBulk   Priority = "bulk"
+)
+
+// Priorities lists the lanes from highest to lowest priority.
+var Priorities = []Priority{PriorityUrgent, PriorityNormal, PriorityBulk}
+
+// laneStarvationLimit is how many jobs may be taken from higher lanes
+// before a waiting lower lane is tried first.
+const laneStarvationLimit = 4
+
+// ParsePriority converts a submission's priority to a lane, defaulting to normal.
+func ParsePriority(s string) Priority {
+	for _, p := range Priorities {
+		if string(p) == s {
+			return p
+		}
+	}
+	return PriorityNormal
+}
+
+// legacyRequestSubject returns the single work-queue subject jobs were published to before
+// there were priority lanes.
+func (s *JobService) legacyRequestSubject() string {
+	return fmt.Sprintf("%s.request", s.subjectPrefix)
+}
+
+// requeueLegacyJobs moves jobs still queued on the legacy subject to the normal lane, so they
+// are not stranded by an upgrade. Each job is republished before it is acknowledged, under an
+// ID derived from its sequence, so a worker stopping halfway moves it once.
+func (s *JobService) requeueLegacyJobs(ctx context.Context) error {
+	limits := mq.ConsumerLimits{AckWait: time.Minute}
+	moved := 0
+	for {
+		msgs, err := s.workQueueMQ.Fetch(ctx, s.legacyRequestSubject(), "request-legacy", limits, 100)
+		if err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			break
+		}
+		for _, msg := range msgs {
+			meta, err := msg.Metadata()
+			if err != nil {
+				return err
+			}
+			msgID := fmt.Sprintf("legacy-%d", meta.Sequence.Stream)
+			if err := s.workQueueMQ.Publish(ctx, s.laneSubject(PriorityNormal), msg.Data(), mq.WithMsgID(msgID)); err != nil {
+				return fmt.Errorf("error requeueing legacy job: %w", err)
+			}
+			if err := msg.Ack(); err != nil {
+				return err
+			}
+			moved++
+		}
+	}
+	if moved > 0 {
+		s.log.Info("Moved legacy jobs to the normal lane", map[string]interface{}{"jobs": moved})
+	}
+	return nil
+}
+
+// laneScheduler decides the order in which lanes are pulled from.
+// Higher lanes always go first, except that a lane passed over laneStarvationLimit
+// times in a row is tried first once, so lower lanes are never starved.
+type laneScheduler struct {
+	skipped map[Priority]int
+}
+
+func newLaneScheduler() *laneScheduler {
+	return &laneScheduler{skipped: make(map[Priority]int)}
+}
+
+// order returns the lanes in the order they should be tried for the next job.
+func (l *laneScheduler) order() []Priority {
+	for i := len(Priorities) - 1; i > 0; i-- {
+		starved := Priorities[i]
+		if l.skipped[starved] < laneStarvationLimit {
+			continue
+		}
+		order := []Priority{starved}
+		for _, p := range Priorities {
+			if p != starved {
+				order = append(order, p)
+			}
+		}
+		return order
+	}
+	return Priorities
+}
+
+// served records that a job was taken from the given lane, passing over every lane below it.
+func (l *laneScheduler) served(lane Priority) {
+	below := false
+	for _, p := range Priorities {
+		if below {
+			l.skipped[p]++
+		}
+		if p == lane {
+			below = true
+			l.skipped[p] = 0
+		}
+	}
+}
+
+// empty records that a lane had no jobs, so it is not waiting to be served.
+func (l *laneScheduler) empty(lane Priority) {
+	l.skipped[lane] = 0
+}
@@ -0,0 +1,130 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Task states reported by Nextflow.
+const (
+	TaskRunning   = "RUNNING"
+	TaskCompleted = "COMPLETED"
+	TaskFailed    = "FAILED"
+	TaskCached    = "CACHED"
+	TaskAborted   = "ABORTED"
+)
+
+// TaskEventMetadata is the task carried by a process event from the nf-nats plugin.
+type TaskEventMetadata struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// TaskState is the latest known state of one task of a run.
+type TaskState struct {
+	Process string `json:"process"`
+	Status  string `json:"status"`
+}
+
+// ProcessProgress counts the tasks of a process, or of a whole run, by state.
+type ProcessProgress struct {
+	Submitted int `json:"submitted"`
+	Running   int `json:"running"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+	Cached    int `json:"cached"`
+}
+
+// Progress summarises the tasks of a run, overall and per process.
+type Progress struct {
+	ProcessProgress
+	Percent   int                        `json:"percent"` // Share of submitted tasks that have finished
+	Processes map[string]ProcessProgress `json:"processes"`
+}
+
+// ProgressEventMetadata defines metadata for job progress events. Progress.Processes only holds
+// the processes whose counts changed since the previous event.
+type ProgressEventMetadata struct {
+	JobID    string   `json:"jobid"`
+	Progress Progress `json:"progress"`
+}
+
+// processName returns the process a task belongs to by dropping the task tag,
+// e.g. "WF:FASTQC (sample1)" becomes "WF:FASTQC".
+func processName(task string) string {
+	name, _, _ := strings.Cut(task, " (")
+	return name
+}
+
+// ApplyTaskEvent records a process event in the task states of a run. A start event
+// never overrides a task that has already finished, so late deliveries are harmless.
+func ApplyTaskEvent(tasks map[string]TaskState, event Event[TaskEventMetadata]) {
+	id := strconv.Itoa(event.MetaData.ID)
+	state := TaskState{Process: processName(event.MetaData.Name), Status: event.MetaData.Status}
+
+	switch event.Type {
+	case "process.start":
+		if _, seen := tasks[id]; seen {
+			return
+		}
+		state.Status = TaskRunning
+	case "process.complete":
+		if state.Status == "" || state.Status == TaskRunning {
+			state.Status = TaskCompleted
+		}
+	default:
+		return
+	}
+	tasks[id] = state
+}
+
+// SummarizeProgress counts task states overall and per process.
+func SummarizeProgress(tasks map[string]TaskState) Progress {
+	progress := Progress{Processes: make(map[string]ProcessProgress)}
+	for _, task := range tasks {
+		process := progress.Processes[task.Process]
+		for _, counts := range []*ProcessProgress{&progress.ProcessProgress, &process} {
+			counts.Submitted++
+			switch task.Status {
+			case TaskRunning:
+				counts.Running++
+			case TaskCompleted:
+				counts.Completed++
+			case TaskCached:
+				counts.Cached++
+			default:
+				counts.Failed++
+			}
+		}
+		progress.Processes[task.Process] = process
+	}
+	if progress.Submitted > 0 {
+		progress.Percent = 100 * (progress.Submitted - progress.Running) / progress.Submitted
+	}
+	return progress
+}
+
+// PublishProgress publishes a job.progress event alongside the job's other events.
+func (s *JobService) PublishProgress(ctx context.Context, id string, progress Progress) error {
+	event := Event[ProgressEventMetadata]{
+		Type: "job.progress",
+		Message: fmt.Sprintf("Job %s progress: %d of %d tasks finished (%d failed)",
+			id, progress.Submitted-progress.Running, progress.Submitted, progress.Failed),
+		TimeStamp: time.Now().Format(time.RFC3339),
+		MetaData: ProgressEventMetadata{
+			JobID:    id,
+			Progress: progress,
+		},
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	subj := fmt.Sprintf("%s.events.%s.progress", s.subjectPrefix, id)
+	return s.eventMQ.Publish(ctx, subj, data)
+}
@@ -0,0 +1,115 @@
+package jobs
+
+import "testing"
+
+func taskEvent(kind string, id int, name, status string) Event[TaskEventMetadata] {
+	return Event[TaskEventMetadata]{Type: kind, MetaData: TaskEventMetadata{ID: id, Name: name, Status: status}}
+}
+
+func TestTaskProgress(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []Event[TaskEventMetadata]
+		want   ProcessProgress
+		// processes holds the expected counts of each process, if checked.
+		processes map[string]ProcessProgress
+		percent   int
+	}{
+		{
+			name: "running and finished tasks",
+			events: []Event[TaskEventMetadata]{
+				taskEvent("process.start", 1, "WF:FASTQC (s1)", ""),
+				taskEvent("process.start", 2, "WF:FASTQC (s2)", ""),
+				taskEvent("process.start", 3, "WF:ALIGN (s1)", ""),
+				taskEvent("process.complete", 1, "WF:FASTQC (s1)", TaskCompleted),
+				taskEvent("process.complete", 3, "WF:ALIGN (s1)", TaskFailed),
+			},
+			want: ProcessProgress{Submitted: 3, Running: 1, Completed: 1, Failed: 1},
+			processes: map[string]ProcessProgress{
+				"WF:FASTQC": {Submitted: 2, Running: 1, Completed: 1},
+				"WF:ALIGN":  {Submitted: 1, Failed: 1},
+			},
+			percent: 66,
+		},
+		{
+			name: "late start after completion",
+			events: []Event[TaskEventMetadata]{
+				taskEvent("process.complete", 1, "WF:FASTQC (s1)", ""),
+				taskEvent("process.start", 1, "WF:FASTQC (s1)", ""),
+			},
+			want:    ProcessProgress{Submitted: 1, Completed: 1},
+			percent: 100,
+		},
+		{
+			name: "cached task",
+			events: []Event[TaskEventMetadata]{
+				taskEvent("process.complete", 1, "WF:FASTQC (s1)", TaskCached),
+			},
+			want:    ProcessProgress{Submitted: 1, Cached: 1},
+			percent: 100,
+		},
+		{
+			name: "other events ignored",
+			events: []Event[TaskEventMetadata]{
+				taskEvent("workflow.start", 0, "", ""),
+			},
+			want: ProcessProgress{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks := make(map[string]TaskState)
+			for _, event := range tt.events {
+				ApplyTaskEvent(tasks, event)
+			}
+			progress := SummarizeProgress(tasks)
+			if progress.ProcessProgress != tt.want {
+				t.Errorf("progress = %+v, want %+v", progress.ProcessProgress, tt.want)
+			}
+			if progress.Percent != tt.percent {
+				t.Errorf("percent = %d, want %d", progress.Percent, tt.percent)
+			}
+			for process, want := range tt.processes {
+				if got := progress.Processes[process]; got != want {
+					t.Errorf("process %s = %+v, want %+v", process, got, want)
+				}
+			}
+		})
+	}
+}
+
+// A new attempt runs Nextflow again, which numbers its tasks from 1 again. Its events must
+// be applied to cleared task states, as the submission's progress is reset when it starts.
+func TestTaskProgressNewAttempt(t *testing.T) {
+	tasks := make(map[string]TaskState)
+	for _, event := range []Event[TaskEventMetadata]{
+		taskEvent("process.start", 1, "WF:FASTQC (s1)", ""),
+		taskEvent("process.complete", 1, "WF:FASTQC (s1)", TaskCompleted),
+		taskEvent("process.start", 2, "WF:ALIGN (s1)", ""),
+		taskEvent("process.complete", 2, "WF:ALIGN (s1)", TaskFailed),
+	} {
+		ApplyTaskEvent(tasks, event)
+	}
+
+	// Without a reset, the retry's first task would keep the finished state of the
+	// previous attempt's task 1 and never show as running.
+	stale := make(map[string]TaskState)
+	for id, state := range tasks {
+		stale[id] = state
+	}
+	ApplyTaskEvent(stale, taskEvent("process.start", 1, "WF:FASTQC (s1)", ""))
+	if got := SummarizeProgress(stale); got.Running != 0 || got.Failed != 1 {
+		t.Fatalf("stale progress = %+v, expected the previous attempt's counts", got.ProcessProgress)
+	}
+
+	tasks = make(map[string]TaskState)
+	ApplyTaskEvent(tasks, taskEvent("process.start", 1, "WF:FASTQC (s1)", ""))
+	progress := SummarizeProgress(tasks)
+	want := ProcessProgress{Submitted: 1, Running: 1}
+	if progress.ProcessProgress != want {
+		t.Fatalf("progress = %+v, want %+v", progress.ProcessProgress, want)
+	}
+	if _, ok := progress.Processes["WF:ALIGN"]; ok {
+		t.Fatalf("processes = %v, want none from the previous attempt", progress.Processes)
+	}
+}
@@ -0,0 +1,258 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aligndx/aligndx/internal/jobs/mq"
+	"github.com/aligndx/aligndx/internal/resources"
+)
+
+// WorkerState is the lifecycle state a worker reports in its heartbeats.
+type WorkerState string
+
+const (
+	WorkerRunning  WorkerState = "running"
+	WorkerDraining WorkerState = "draining" // Finishing its running jobs before it stops, and not taking new ones
+	WorkerPaused   WorkerState = "paused"   // Not taking new jobs until it is resumed
+	WorkerStopped  WorkerState = "stopped"
+)
+
+// WorkerInfo is a worker heartbeat, as published by the worker and kept by the registry.
+type WorkerInfo struct {
+	ID           string              `json:"id"`
+	Hostname     string              `json:"hostname"`
+	Version      string              `json:"version"`
+	State        WorkerState         `json:"state"`
+	Concurrency  int                 `json:"concurrency"`
+	Capacity     resources.Resources `json:"capacity"`
+	Labels       map[string]string   `json:"labels,omitempty"`
+	JobTypes     map[string]int      `json:"job_types"` // Version of each job schema the worker runs
+	RunningJobs  []string            `json:"running_jobs"`
+	RunningUsers map[string]int      `json:"running_users,omitempty"` // Number of running jobs of each user
+	StartedAt    time.Time           `json:"started_at"`
+	LastSeen     time.Time           `json:"last_seen"`
+	Stale        bool                `json:"stale"`                        // Set by the registry when heartbeats are overdue
+	Mismatches   []string            `json:"version_mismatches,omitempty"` // Set by the registry for job schemas whose version differs from the API's
+}
+
+// workerSubject returns the heartbeat subject for a worker.
+func (s *JobService) workerSubject(workerID string) string {
+	return fmt.Sprintf("%s.workers.%s", s.subjectPrefix, workerID)
+}
+
+// PublishWorkerHeartbeat publishes a worker's current state. Only the latest heartbeat of each worker is kept.
+func (s *JobService) PublishWorkerHeartbeat(ctx context.Context, info WorkerInfo) error {
+	info.LastSeen = time.Now()
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to marshal heartbeat: %w", err)
+	}
+	return s.workerMQ.Publish(ctx, s.workerSubject(info.ID), data)
+}
+
+// SetWorkerID names the worker this service runs jobs for. The ID is reported with the
+// statuses the service publishes.
+func (s *JobService) SetWorkerID(id string) {
+	s.workerID = id
+}
+
+// RunningUsers returns how many jobs each user has running in this service. Jobs without a user are not counted.
+func (s *JobService) RunningUsers() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := make(map[string]int)
+	for _, job := range s.running {
+		if job.userID != "" {
+			users[job.userID]++
+		}
+	}
+	return users
+}
+
+// RunningJobs returns the IDs of the jobs currently running in this service.
+func (s *JobService) RunningJobs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.running))
+	for id := range s.running {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// WorkerRegistry keeps the live set of workers, built from their latest heartbeats.
+// Workers whose heartbeats are overdue are flagged as stale; once they have been silent
+// for long enough they are dropped and the jobs they were running are marked as lost.
+type WorkerRegistry struct {
+	s          *JobService
+	staleAfter time.Duration
+	lostAfter  time.Duration
+
+	mu      sync.RWMutex
+	workers map[string]WorkerInfo
+}
+
+// WatchWorkers starts a worker registry that refreshes itself until the context is done.
+func (s *JobService) WatchWorkers(ctx context.Context) *WorkerRegistry {
+	r := &WorkerRegistry{
+		s:          s,
+		staleAfter: s.cfg.Worker.StaleAfter,
+		lostAfter:  s.cfg.Worker.LostAfter,
+		workers:    make(map[string]WorkerInfo),
+	}
+
+	interval := s.cfg.Worker.HeartbeatInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			r.refresh(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return r
+}
+
+// Workers returns the known workers ordered by ID.
+func (r *WorkerRegistry) Workers() []WorkerInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	workers := make([]WorkerInfo, 0, len(r.workers))
+	for _, info := range r.workers {
+		workers = append(workers, info)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].ID < workers[j].ID })
+	return workers
+}
+
+// Worker returns a known worker by ID.
+func (r *WorkerRegistry) Worker(id string) (WorkerInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	info, ok := r.workers[id]
+	return info, ok
+}
+
+// refresh reloads the latest heartbeats and handles workers that stopped or went silent.
+func (r *WorkerRegistry) refresh(ctx context.Context) {
+	msgs, err := r.s.workerMQ.LastMessages(ctx, r.s.workerSubject("*"))
+	if err != nil {
+		r.s.log.Error("Failed to load worker heartbeats", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	workers := make(map[string]WorkerInfo, len(msgs))
+	claimed := make(map[string]struct{})
+	var lost []mq.StoredMessage
+	for _, msg := range msgs {
+		var info WorkerInfo
+		if err := json.Unmarshal(msg.Data, &info); err != nil {
+			r.s.log.Error("Failed to unmarshal worker heartbeat", map[string]interface{}{"subject": msg.Subject, "error": err.Error()})
+			continue
+		}
+
+		silent := now.Sub(info.LastSeen)
+		switch {
+		case info.State == WorkerStopped:
+			// The worker returned its jobs to the queue on the way out.
+			r.forget(ctx, info, msg.Sequence)
+			continue
+		case r.lostAfter > 0 && silent > r.lostAfter:
+			lost = append(lost, msg)
+			continue
+		}
+
+		info.Stale = r.staleAfter > 0 && silent > r.staleAfter
+		info.Mismatches = r.versionMismatches(info)
+		if len(info.Mismatches) > 0 && !r.known(info.ID) {
+			r.s.log.Warn("Worker runs different job versions", map[string]interface{}{"worker_id": info.ID, "mismatches": info.Mismatches})
+		}
+		workers[info.ID] = info
+		for _, id := range info.RunningJobs {
+			claimed[id] = struct{}{}
+		}
+	}
+
+	for _, msg := range lost {
+		var info WorkerInfo
+		_ = json.Unmarshal(msg.Data, &info)
+		r.lose(ctx, info, msg.Sequence, claimed)
+	}
+
+	r.mu.Lock()
+	r.workers = workers
+	r.mu.Unlock()
+}
+
+// versionMismatches describes each job schema a worker runs at a different version than this service.
+func (r *WorkerRegistry) versionMismatches(info WorkerInfo) []string {
+	var mismatches []string
+	for schema, version := range r.s.JobTypes() {
+		workerVersion, ok := info.JobTypes[schema]
+		switch {
+		case !ok:
+			mismatches = append(mismatches, fmt.Sprintf("%s: api v%d, worker missing", schema, version))
+		case workerVersion != version:
+			mismatches = append(mismatches, fmt.Sprintf("%s: api v%d, worker v%d", schema, version, workerVersion))
+		}
+	}
+	sort.Strings(mismatches)
+	return mismatches
+}
+
+// known reports whether a worker was in the registry before the current refresh.
+func (r *WorkerRegistry) known(id string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.workers[id]
+	return ok
+}
+
+// forget removes a worker's heartbeat so it is not seen again.
+func (r *WorkerRegistry) forget(ctx context.Context, info WorkerInfo, seq uint64) {
+	if err := r.s.workerMQ.DeleteMessage(ctx, seq); err != nil && !errors.Is(err, mq.ErrMessageNotFound) {
+		r.s.log.Error("Failed to remove worker heartbeat", map[string]interface{}{"worker_id": info.ID, "error": err.Error()})
+	}
+}
+
+// lose marks the jobs of a silent worker as lost and drops the worker. The jobs were never
+// acknowledged, so the work queue redelivers them once their ack wait runs out.
+func (r *WorkerRegistry) lose(ctx context.Context, info WorkerInfo, seq uint64, claimed map[string]struct{}) {
+	r.s.log.Warn("Worker lost", map[string]interface{}{"worker_id": info.ID, "last_seen": info.LastSeen.Format(time.RFC3339), "jobs": info.RunningJobs})
+
+	reason := fmt.Sprintf("worker %s stopped sending heartbeats, job will be requeued", info.ID)
+	for _, id := range info.RunningJobs {
+		if _, ok := claimed[id]; ok {
+			continue // Already redelivered to a live worker.
+		}
+		// A status published after the last heartbeat means the job has moved on without this worker.
+		last, err := r.s.eventMQ.LastMessage(ctx, r.s.statusSubject(id))
+		if err == nil && last.Time.After(info.LastSeen) {
+			continue
+		}
+		if err := r.s.updateJobStatus(ctx, id, StatusLost, reason); err != nil {
+			r.s.log.Error("Failed to update job status", map[string]interface{}{"job_id": id, "error": err.Error()})
+		}
+	}
+	r.forget(ctx, info, seq)
+}
@@ -0,0 +1,104 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/aligndx/aligndx/internal/jobs/mq"
+)
+
+// RetryPolicy controls how often and how quickly a failed job is retried.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+}
+
+// DefaultRetryPolicy runs a job once, without retries.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 1}
+
+// Backoff returns the delay to wait after the given (1-based) failed attempt.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := math.Max(p.Multiplier, 1)
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(delay)
+}
+
+// registeredHandler is a job type together with its options.
+type registeredHandler struct {
+	jobType JobType
+	retry   RetryPolicy
+}
+
+// HandlerOption configures a registered job handler.
+type HandlerOption func(*registeredHandler)
+
+// WithRetryPolicy sets the retry policy used when the handler fails.
+func WithRetryPolicy(policy RetryPolicy) HandlerOption {
+	return func(h *registeredHandler) {
+		h.retry = policy
+	}
+}
+
+// AttemptEventMetadata records that a worker started running a job. Attempts are counted per
+// work-queue message, so only executions count towards the retry policy; deliveries a worker
+// hands back without running the job do not.
+type AttemptEventMetadata struct {
+	JobID    string `json:"jobid"`
+	Attempt  int    `json:"attempt"`
+	Sequence uint64 `json:"sequence"` // Work-queue stream sequence of the message the job ran from
+	Worker   string `json:"worker,omitempty"`
+}
+
+// attemptSubject returns the attempt event subject of a job.
+func (s *JobService) attemptSubject(jobID string) string {
+	return fmt.Sprintf("%s.events.attempt.%s", s.subjectPrefix, jobID)
+}
+
+// previousAttempts returns how many times the job has been run from the work-queue message with
+// the given sequence. A job queued again, by a resume or from the dead-letter queue, is a new
+// message and starts from zero.
+func (s *JobService) previousAttempts(ctx context.Context, jobID string, seq uint64) int {
+	last, err := s.eventMQ.LastMessage(ctx, s.attemptSubject(jobID))
+	if err != nil {
+		if !errors.Is(err, mq.ErrMessageNotFound) {
+			s.log.Error("Failed to load job attempts", map[string]interface{}{"job_id": jobID, "error": err.Error()})
+		}
+		return 0
+	}
+	var event Event[AttemptEventMetadata]
+	if err := json.Unmarshal(last.Data, &event); err != nil || event.MetaData.Sequence != seq {
+		return 0
+	}
+	return event.MetaData.Attempt
+}
+
+// recordAttempt publishes the number of times the job has been run from the work-queue message with the given sequence.
+func (s *JobService) recordAttempt(ctx context.Context, jobID string, attempt int, seq uint64) {
+	event := Event[AttemptEventMetadata]{
+		Type:      "job.attempt",
+		Message:   fmt.Sprintf("Job %s attempt %d", jobID, attempt),
+		TimeStamp: time.Now().Format(time.RFC3339),
+		MetaData: AttemptEventMetadata{
+			JobID:    jobID,
+			Attempt:  attempt,
+			Sequence: seq,
+			Worker:   s.workerID,
+		},
+	}
+	data, err := json.Marshal(event)
+	if err == nil {
+		err = s.eventMQ.Publish(ctx, s.attemptSubject(jobID), data)
+	}
+	if err != nil {
+		s.log.Error("Failed to record job attempt", map[string]interface{}{"job_id": jobID, "attempt": attempt, "error": err.Error()})
+	}
+}
@@ -0,0 +1,28 @@
+package jobs
+
+import "slices"
+
+// statusTransitions lists the statuses a job may move to from each status. Finished jobs
+// only move on when they are queued again, i.e. resumed or requeued from the dead-letter queue.
+var statusTransitions = map[JobStatus][]JobStatus{
+	StatusCreated:    {StatusQueued, StatusWaiting, StatusError, StatusCancelled},
+	StatusWaiting:    {StatusQueued, StatusError, StatusCancelled},
+	StatusQueued:     {StatusProcessing, StatusError, StatusCancelled, StatusLost},
+	StatusProcessing: {StatusQueued, StatusCompleted, StatusError, StatusCancelled, StatusRetrying, StatusTimeout, StatusLost},
+	StatusRetrying:   {StatusQueued, StatusProcessing, StatusError, StatusCancelled, StatusLost},
+	StatusLost:       {StatusQueued, StatusProcessing, StatusCompleted, StatusError, StatusCancelled, StatusRetrying, StatusTimeout},
+	StatusError:      {StatusQueued},
+	StatusCancelled:  {StatusQueued},
+	StatusTimeout:    {StatusQueued},
+	StatusCompleted:  {},
+}
+
+// CanTransitionTo reports whether a job in status s may move to next. Repeating a status,
+// e.g. to update its reason, is always allowed, as is any move from an unknown status.
+func (s JobStatus) CanTransitionTo(next JobStatus) bool {
+	if s == next {
+		return true
+	}
+	allowed, known := statusTransitions[s]
+	return !known || slices.Contains(allowed, next)
+}
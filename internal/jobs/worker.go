@@ -2,6 +2,9 @@ package jobs
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"os"
 	"os/signal"
 	"sync"
@@ -9,8 +12,9 @@ import (
 	"time"
 
 	"github.com/aligndx/aligndx/internal/config"
-	"github.com/aligndx/aligndx/internal/jobs/handlers/workflow"
 	"github.com/aligndx/aligndx/internal/logger"
+	"github.com/aligndx/aligndx/internal/nextflow"
+	"github.com/aligndx/aligndx/internal/version"
 )
 
 // Start initializes the worker's dependencies and starts the job processing.
@@ -29,7 +33,7 @@ func StartWorker(ctx context.Context, cancel context.CancelFunc) error {
 	}
 
 	// Register job handlers.
-	jobService.RegisterJobHandler("workflow", workflow.WorkflowHandler)
+	RegisterDefaultJobs(jobService)
 
 	// Create a worker instance and run it.
 	worker := NewWorker(jobService, log, cfg)
@@ -41,36 +45,179 @@ type Worker struct {
 	jobService JobServiceInterface
 	log        *logger.LoggerWrapper
 	cfg        *config.Config
+	info       WorkerInfo
 }
 
 func NewWorker(jobService JobServiceInterface, log *logger.LoggerWrapper, cfg *config.Config) *Worker {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	capacity, err := workerCapacity(cfg.Worker)
+	if err != nil {
+		log.Error("Failed to detect worker resources", map[string]interface{}{"error": err.Error()})
+	}
+
+	id := cfg.Worker.ID
+	if id == "" {
+		id = newWorkerID(hostname)
+	}
+	jobService.SetWorkerID(id)
+
 	return &Worker{
 		jobService: jobService,
 		log:        log,
 		cfg:        cfg,
+		info: WorkerInfo{
+			ID:          id,
+			Hostname:    hostname,
+			Version:     version.Version,
+			Concurrency: max(cfg.Worker.Concurrency, 1),
+			Capacity:    capacity,
+			Labels:      cfg.Worker.Labels,
+			StartedAt:   time.Now(),
+		},
+	}
+}
+
+// newWorkerID returns a worker ID made of the hostname and a random suffix, so
+// several workers on one host can be told apart.
+func newWorkerID(hostname string) string {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	return fmt.Sprintf("%s-%s", hostname, hex.EncodeToString(suffix))
+}
+
+// heartbeat publishes the worker's state with the jobs it is running.
+func (w *Worker) heartbeat(ctx context.Context, state WorkerState) {
+	info := w.info
+	info.State = state
+	if state == WorkerRunning && w.jobService.Paused() {
+		info.State = WorkerPaused
+	}
+	info.RunningJobs = w.jobService.RunningJobs()
+	info.RunningUsers = w.jobService.RunningUsers()
+	info.JobTypes = w.jobService.JobTypes()
+	if err := w.jobService.PublishWorkerHeartbeat(ctx, info); err != nil {
+		w.log.Error("Failed to publish heartbeat", map[string]interface{}{"worker_id": info.ID, "error": err.Error()})
+	}
+}
+
+// sendHeartbeats publishes a heartbeat with the given state every interval until the context is done.
+func (w *Worker) sendHeartbeats(ctx context.Context, state WorkerState) {
+	interval := w.cfg.Worker.HeartbeatInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		w.heartbeat(ctx, state)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drain waits for running jobs to finish, up to the drain timeout or until ctx is done,
+// reporting the worker as draining meanwhile.
+func (w *Worker) drain(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, max(w.cfg.Worker.DrainTimeout, 0))
+	defer cancel()
+
+	// Stop reporting the worker as draining before it reports itself stopped.
+	heartbeatCtx, stopHeartbeats := context.WithCancel(context.Background())
+	heartbeatsDone := make(chan struct{})
+	defer func() {
+		stopHeartbeats()
+		<-heartbeatsDone
+	}()
+	go func() {
+		defer close(heartbeatsDone)
+		w.sendHeartbeats(heartbeatCtx, WorkerDraining)
+	}()
+
+	w.log.Info("Draining worker", map[string]interface{}{"running_jobs": w.jobService.RunningJobs(), "timeout": w.cfg.Worker.DrainTimeout.String()})
+	if err := w.jobService.Drain(ctx); err != nil {
+		w.log.Warn("Worker drain incomplete", map[string]interface{}{"error": err.Error()})
 	}
 }
 
-// Run starts processing jobs and listens for graceful shutdown signals.
+// retentionCheckInterval is how often a worker looks for failed runs past their retention.
+const retentionCheckInterval = time.Hour
+
+// cleanupRetainedRuns removes the work of failed runs that were not resumed within the
+// retention period, until the context is done.
+func (w *Worker) cleanupRetainedRuns(ctx context.Context) {
+	ticker := time.NewTicker(retentionCheckInterval)
+	defer ticker.Stop()
+	for {
+		removed, err := nextflow.CleanupRetained(w.cfg.NXF.RetainFor)
+		if err != nil {
+			w.log.Error("Failed to clean up retained runs", map[string]interface{}{"error": err.Error()})
+		}
+		for _, dir := range removed {
+			w.log.Info("Removed expired run", map[string]interface{}{"dir": dir})
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run starts processing jobs and listens for graceful shutdown signals. On the first signal the
+// worker stops taking jobs and drains: running jobs get up to the drain timeout to finish before
+// they are returned to the queue. A second signal returns them straight away.
 func (w *Worker) Run(ctx context.Context, cancel context.CancelFunc) error { // Changed from Start to Run
 	var wg sync.WaitGroup
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
-	// Handle shutdown signal
+	drainCtx, abortDrain := context.WithCancel(context.Background())
+	defer abortDrain()
+
+	// Handle shutdown signals
 	go func() {
 		<-sigs
 		w.log.Info("Shutting down worker...")
 		cancel()
+		<-sigs
+		w.log.Info("Stopping running jobs...")
+		abortDrain()
 	}()
 
-	w.log.Debug("Starting worker to process jobs...")
+	w.log.Debug("Starting worker to process jobs...", map[string]interface{}{"worker_id": w.info.ID})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.sendHeartbeats(ctx, WorkerRunning)
+	}()
+
+	if w.cfg.NXF.RetainFor > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.cleanupRetainedRuns(ctx)
+		}()
+	}
+
+	// Answer control requests from the API while the worker runs
+	if err := w.jobService.ServeControl(ctx); err != nil {
+		w.log.Error("Failed to serve control requests", map[string]interface{}{"error": err.Error()})
+	}
 
 	// Start processing jobs
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		err := w.jobService.Process(ctx, 2)
+		err := w.jobService.Process(ctx, max(w.cfg.Worker.Concurrency, 1))
 		if err != nil {
 			w.log.Error("Error processing jobs", map[string]interface{}{"error": err.Error()})
 			time.Sleep(5 * time.Second)
@@ -78,7 +225,14 @@ func (w *Worker) Run(ctx context.Context, cancel context.CancelFunc) error { //
 	}()
 
 	<-ctx.Done()
-	w.log.Debug("Worker has been shut down")
 	wg.Wait()
+	w.drain(drainCtx)
+
+	// Tell the registry this worker left on purpose, so its jobs are not reported as lost.
+	stopCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	w.heartbeat(stopCtx, WorkerStopped)
+
+	w.log.Debug("Worker has been shut down")
 	return nil
 }
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"context"
+	"sync/atomic"
 
 	"github.com/aligndx/aligndx/internal/config"
 )
@@ -34,32 +35,48 @@ func NewLoggerWrapper(loggerType string, ctx context.Context) *LoggerWrapper {
 
 }
 
+// levelOverride is the process-wide level set at runtime, which takes precedence over the configured one.
+var levelOverride atomic.Pointer[LogLevel]
+
+// SetLevel changes the minimum level of every logger in the process, including ones created later.
+func SetLevel(level LogLevel) {
+	levelOverride.Store(&level)
+}
+
+// Level returns the minimum level this logger writes.
+func (lw *LoggerWrapper) Level() LogLevel {
+	if level := levelOverride.Load(); level != nil {
+		return *level
+	}
+	return lw.minLevel
+}
+
 func (lw *LoggerWrapper) Debug(msg string, fields ...map[string]interface{}) {
-	if DebugLevel >= lw.minLevel {
+	if DebugLevel >= lw.Level() {
 		lw.logger.Debug(msg, fields...)
 	}
 }
 
 func (lw *LoggerWrapper) Info(msg string, fields ...map[string]interface{}) {
-	if InfoLevel >= lw.minLevel {
+	if InfoLevel >= lw.Level() {
 		lw.logger.Info(msg, fields...)
 	}
 }
 
 func (lw *LoggerWrapper) Warn(msg string, fields ...map[string]interface{}) {
-	if WarnLevel >= lw.minLevel {
+	if WarnLevel >= lw.Level() {
 		lw.logger.Warn(msg, fields...)
 	}
 }
 
 func (lw *LoggerWrapper) Error(msg string, fields ...map[string]interface{}) {
-	if ErrorLevel >= lw.minLevel {
+	if ErrorLevel >= lw.Level() {
 		lw.logger.Error(msg, fields...)
 	}
 }
 
 func (lw *LoggerWrapper) Fatal(msg string, fields ...map[string]interface{}) {
-	if FatalLevel >= lw.minLevel {
+	if FatalLevel >= lw.Level() {
 		lw.logger.Fatal(msg, fields...)
 	}
 }
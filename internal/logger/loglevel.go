@@ -15,28 +15,54 @@ const (
 	FatalLevel
 )
 
+// ParseLevel parses a level name or number, falling back to InfoLevel for anything it does not recognise.
 func ParseLevel(s string) LogLevel {
+	if level, ok := LookupLevel(s); ok {
+		return level
+	}
+	return InfoLevel
+}
+
+// LookupLevel parses a level name or number, reporting whether it is a known level.
+func LookupLevel(s string) (LogLevel, bool) {
 	// Try numeric
 	if i, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
 		switch LogLevel(i) {
 		case DebugLevel, InfoLevel, WarnLevel, ErrorLevel, FatalLevel:
-			return LogLevel(i)
+			return LogLevel(i), true
 		}
 	}
 
 	// Fallback to name
 	switch strings.ToLower(strings.TrimSpace(s)) {
 	case "debug":
-		return DebugLevel
+		return DebugLevel, true
 	case "info":
-		return InfoLevel
+		return InfoLevel, true
 	case "warn", "warning":
-		return WarnLevel
+		return WarnLevel, true
 	case "error":
-		return ErrorLevel
+		return ErrorLevel, true
 	case "fatal":
-		return FatalLevel
+		return FatalLevel, true
+	default:
+		return InfoLevel, false
+	}
+}
+
+func (l LogLevel) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	case FatalLevel:
+		return "fatal"
 	default:
-		return InfoLevel
+		return strconv.Itoa(int(l))
 	}
 }
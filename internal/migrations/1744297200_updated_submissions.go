@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pte4fn5mi541cxc")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(8, []byte(`{
+			"hidden": false,
+			"id": "select1655102503",
+			"maxSelect": 1,
+			"name": "priority",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "select",
+			"values": [
+				"urgent",
+				"normal",
+				"bulk"
+			]
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pte4fn5mi541cxc")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("select1655102503")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,92 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pte4fn5mi541cxc")
+		if err != nil {
+			return err
+		}
+
+		// update field
+		if err := collection.Fields.AddMarshaledJSONAt(7, []byte(`{
+			"hidden": false,
+			"id": "fopmotas",
+			"maxSelect": 1,
+			"name": "status",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "select",
+			"values": [
+				"created",
+				"queued",
+				"processing",
+				"completed",
+				"error",
+				"cancelled",
+				"retrying",
+				"lost",
+				"timeout"
+			]
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(9, []byte(`{
+			"hidden": false,
+			"id": "number3726413150",
+			"max": null,
+			"min": 0,
+			"name": "max_runtime",
+			"onlyInt": true,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pte4fn5mi541cxc")
+		if err != nil {
+			return err
+		}
+
+		// update field
+		if err := collection.Fields.AddMarshaledJSONAt(7, []byte(`{
+			"hidden": false,
+			"id": "fopmotas",
+			"maxSelect": 1,
+			"name": "status",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "select",
+			"values": [
+				"created",
+				"queued",
+				"processing",
+				"completed",
+				"error",
+				"cancelled",
+				"retrying",
+				"lost"
+			]
+		}`)); err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("number3726413150")
+
+		return app.Save(collection)
+	})
+}
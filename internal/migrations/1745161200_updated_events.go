@@ -0,0 +1,124 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("i5fj8bq7191oxdv")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		collection.ListRule = types.Pointer("@request.auth.id != \"\" && submission.user.id ?= @request.auth.id")
+		collection.ViewRule = types.Pointer("@request.auth.id != \"\" && submission.user.id ?= @request.auth.id")
+		collection.AddIndex("idx_events_stream_seq", true, "`stream_seq`, `published`", "")
+		collection.AddIndex("idx_events_submission", false, "`submission`", "")
+
+		// add fields
+		if err := collection.Fields.AddMarshaledJSONAt(4, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text1542800728",
+			"max": 0,
+			"min": 0,
+			"name": "timestamp",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := collection.Fields.AddMarshaledJSONAt(5, []byte(`{
+			"cascadeDelete": true,
+			"collectionId": "pte4fn5mi541cxc",
+			"hidden": false,
+			"id": "relation1309844404",
+			"maxSelect": 1,
+			"minSelect": 0,
+			"name": "submission",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "relation"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := collection.Fields.AddMarshaledJSONAt(6, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text2860347453",
+			"max": 0,
+			"min": 0,
+			"name": "subject",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := collection.Fields.AddMarshaledJSONAt(7, []byte(`{
+			"hidden": false,
+			"id": "number2093472300",
+			"max": null,
+			"min": 0,
+			"name": "stream_seq",
+			"onlyInt": true,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := collection.Fields.AddMarshaledJSONAt(8, []byte(`{
+			"hidden": false,
+			"id": "date3521727813",
+			"max": "",
+			"min": "",
+			"name": "published",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "date"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("i5fj8bq7191oxdv")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		collection.ListRule = nil
+		collection.ViewRule = nil
+		collection.RemoveIndex("idx_events_stream_seq")
+		collection.RemoveIndex("idx_events_submission")
+
+		// remove fields
+		collection.Fields.RemoveById("text1542800728")
+		collection.Fields.RemoveById("relation1309844404")
+		collection.Fields.RemoveById("text2860347453")
+		collection.Fields.RemoveById("number2093472300")
+		collection.Fields.RemoveById("date3521727813")
+
+		return app.Save(collection)
+	})
+}
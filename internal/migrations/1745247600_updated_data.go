@@ -0,0 +1,69 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("270xb773aehpc4p")
+		if err != nil {
+			return err
+		}
+
+		// add fields
+		if err := collection.Fields.AddMarshaledJSONAt(9, []byte(`{
+			"hidden": false,
+			"id": "select2063623452",
+			"maxSelect": 1,
+			"name": "status",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "select",
+			"values": [
+				"queued",
+				"processing",
+				"completed",
+				"error",
+				"cancelled",
+				"retrying",
+				"lost",
+				"timeout"
+			]
+		}`)); err != nil {
+			return err
+		}
+
+		if err := collection.Fields.AddMarshaledJSONAt(10, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text1587448267",
+			"max": 0,
+			"min": 0,
+			"name": "status_reason",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("270xb773aehpc4p")
+		if err != nil {
+			return err
+		}
+
+		// remove fields
+		collection.Fields.RemoveById("select2063623452")
+		collection.Fields.RemoveById("text1587448267")
+
+		return app.Save(collection)
+	})
+}
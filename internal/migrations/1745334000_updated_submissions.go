@@ -0,0 +1,72 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pte4fn5mi541cxc")
+		if err != nil {
+			return err
+		}
+
+		// add fields
+		if err := collection.Fields.AddMarshaledJSONAt(14, []byte(`{
+			"hidden": false,
+			"id": "number3412697582",
+			"max": null,
+			"min": 0,
+			"name": "status_seq",
+			"onlyInt": true,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := collection.Fields.AddMarshaledJSONAt(15, []byte(`{
+			"hidden": false,
+			"id": "date2231598125",
+			"max": "",
+			"min": "",
+			"name": "status_at",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "date"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := collection.Fields.AddMarshaledJSONAt(16, []byte(`{
+			"hidden": false,
+			"id": "json1126524736",
+			"maxSize": 0,
+			"name": "status_history",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "json"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pte4fn5mi541cxc")
+		if err != nil {
+			return err
+		}
+
+		// remove fields
+		collection.Fields.RemoveById("number3412697582")
+		collection.Fields.RemoveById("date2231598125")
+		collection.Fields.RemoveById("json1126524736")
+
+		return app.Save(collection)
+	})
+}
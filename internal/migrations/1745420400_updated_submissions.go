@@ -0,0 +1,104 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pte4fn5mi541cxc")
+		if err != nil {
+			return err
+		}
+
+		// add fields
+		if err := collection.Fields.AddMarshaledJSONAt(17, []byte(`{
+			"hidden": false,
+			"id": "date1904219946",
+			"max": "",
+			"min": "",
+			"name": "queued_at",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "date"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := collection.Fields.AddMarshaledJSONAt(18, []byte(`{
+			"hidden": false,
+			"id": "date2341880543",
+			"max": "",
+			"min": "",
+			"name": "started_at",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "date"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := collection.Fields.AddMarshaledJSONAt(19, []byte(`{
+			"hidden": false,
+			"id": "date1385203473",
+			"max": "",
+			"min": "",
+			"name": "finished_at",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "date"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := collection.Fields.AddMarshaledJSONAt(20, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text2591208744",
+			"max": 0,
+			"min": 0,
+			"name": "worker",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := collection.Fields.AddMarshaledJSONAt(21, []byte(`{
+			"hidden": false,
+			"id": "json3150329391",
+			"maxSize": 0,
+			"name": "compute",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "json"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pte4fn5mi541cxc")
+		if err != nil {
+			return err
+		}
+
+		// remove fields
+		collection.Fields.RemoveById("date1904219946")
+		collection.Fields.RemoveById("date2341880543")
+		collection.Fields.RemoveById("date1385203473")
+		collection.Fields.RemoveById("text2591208744")
+		collection.Fields.RemoveById("json3150329391")
+
+		return app.Save(collection)
+	})
+}
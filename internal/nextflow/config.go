@@ -3,11 +3,12 @@ package nextflow
 import (
 	_ "embed"
 	"fmt"
-	"html/template"
+	"net/url"
 	"os"
-	"runtime"
+	"text/template"
 
-	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/aligndx/aligndx/internal/config"
+	"github.com/aligndx/aligndx/internal/resources"
 )
 
 //go:embed templates/nextflow.config.tmpl
@@ -15,43 +16,53 @@ var nextflowConfigTemplate string
 
 type NFConfigParams struct {
 	NatsEnabled          bool
-	NatsURL              string
+	NatsURLEnv           string
 	NatsSubject          string
 	NatsEvents           []string
 	NatsJetStreamEnabled bool
 	MaxCPUs              int
 	MaxMemory            string
+	MaxTime              string
 }
 
-func getSystemResources() (int, string, error) {
-	// Get total logical CPUs
-	numCPUs := runtime.NumCPU()
+// natsURLEnv is the environment variable the Nextflow config reads the NATS URL from. The URL
+// carries credentials, so it is passed to the Nextflow process rather than written to its config.
+const natsURLEnv = "NATS_URL"
 
-	// Get available memory in GB
-	memStats, err := mem.VirtualMemory()
-	if err != nil {
-		return 0, "", fmt.Errorf("failed to get memory stats: %w", err)
+// natsURL returns the server the nf-nats plugin publishes process events to,
+// or an empty string when the message queue is kept in memory and there is no server to reach.
+// A user and password or a token are passed in the URL; other credentials cannot be.
+func natsURL(cfg *config.Config) string {
+	if cfg.MQ.Backend == config.MQBackendMemory {
+		return ""
 	}
-	availableMemoryGB := memStats.Available / (1024 * 1024 * 1024) // Convert to GB
-
-	return numCPUs, fmt.Sprintf("%d.GB", availableMemoryGB), nil
-}
-
-func generateNXFConfig(nats_url string, nats_subject string) (string, error) {
-	numCPUs, availableMemory, err := getSystemResources()
+	u, err := url.Parse(cfg.MQ.URL)
 	if err != nil {
-		return "", err
+		return cfg.MQ.URL
+	}
+	switch {
+	case cfg.MQ.Token != "":
+		u.User = url.User(cfg.MQ.Token)
+	case cfg.MQ.User != "":
+		u.User = url.UserPassword(cfg.MQ.User, cfg.MQ.Password)
 	}
+	return u.String()
+}
 
+// generateNXFConfig writes a Nextflow config that caps the run at the given resources
+// and each process at the given time. Process events are only published when NATS is enabled,
+// to the URL in the natsURLEnv environment variable of the Nextflow process.
+func generateNXFConfig(nats_enabled bool, nats_subject string, limits resources.Resources, maxTime string) (string, error) {
 	// Set up the variables for the template
 	params := NFConfigParams{
-		NatsEnabled:          true,
-		NatsURL:              nats_url,
+		NatsEnabled:          nats_enabled,
+		NatsURLEnv:           natsURLEnv,
 		NatsSubject:          nats_subject,
 		NatsEvents:           []string{"workflow.start", "workflow.error", "workflow.complete", "process.start", "process.complete"},
 		NatsJetStreamEnabled: false,
-		MaxCPUs:              numCPUs,
-		MaxMemory:            availableMemory,
+		MaxCPUs:              limits.CPUs,
+		MaxMemory:            fmt.Sprintf("%d.GB", limits.MemoryGB),
+		MaxTime:              maxTime,
 	}
 
 	// Parse the embedded template
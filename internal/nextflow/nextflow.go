@@ -3,13 +3,17 @@ package nextflow
 import (
 	"context"
 	"fmt"
+	"math"
 	"os"
+	"time"
 
 	"github.com/aligndx/aligndx/internal/config"
 	"github.com/aligndx/aligndx/internal/executor"
 	"github.com/aligndx/aligndx/internal/executor/local"
+	"github.com/aligndx/aligndx/internal/jobs/joblog"
 	"github.com/aligndx/aligndx/internal/logger"
 	pb "github.com/aligndx/aligndx/internal/pb/client"
+	"github.com/aligndx/aligndx/internal/resources"
 )
 
 type NextflowInputs struct {
@@ -19,6 +23,29 @@ type NextflowInputs struct {
 	Inputs     map[string]interface{} `json:"inputs"`
 	UserID     string                 `json:"userid"`
 	JobID      string                 `json:"jobid"`
+	Resume     bool                   `json:"resume,omitempty"`
+}
+
+// runLimits returns the resources reserved for the run by the worker, or the whole machine if none were.
+func runLimits(ctx context.Context) (resources.Resources, error) {
+	if reservation, ok := resources.ReservationFromContext(ctx); ok {
+		return reservation, nil
+	}
+	return resources.System()
+}
+
+// defaultMaxTime caps each process of a run that has no deadline.
+const defaultMaxTime = "1.h"
+
+// runMaxTime returns the longest a process may run: whatever is left of the run's
+// deadline, rounded up to the minute, or the default if the run has none.
+func runMaxTime(ctx context.Context) string {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return defaultMaxTime
+	}
+	minutes := int(math.Ceil(time.Until(deadline).Minutes()))
+	return fmt.Sprintf("%d.m", max(minutes, 1))
 }
 
 type WorkflowPaths struct {
@@ -28,18 +55,25 @@ type WorkflowPaths struct {
 	NXFDir     string
 	LogPath    string
 	ResultsDir string
+	TracePath  string
 }
 
-func Run(ctx context.Context, client *pb.Client, log *logger.LoggerWrapper, cfg *config.Config, inputs NextflowInputs) error {
+func Run(ctx context.Context, client *pb.Client, log *logger.LoggerWrapper, cfg *config.Config, inputs NextflowInputs) (err error) {
 	log.Debug("Preparing working directories")
-	paths, err := prepareWorkingDirectories(inputs.JobID, inputs.Name)
+	paths, err := prepareWorkingDirectories(inputs.JobID, inputs.Name, inputs.Resume)
 	if err != nil {
 		return fmt.Errorf("failed to generate directories: %w", err)
 	}
-	defer os.RemoveAll(paths.JobDir)
+	defer func() { finishRun(log, paths, err != nil) }()
+	sessionID := resumeSessionID(log, inputs, paths)
+
+	limits, err := runLimits(ctx)
+	if err != nil {
+		return err
+	}
 
 	log.Debug("Generating config")
-	configPath, err := generateNXFConfig(cfg.MQ.URL, fmt.Sprintf("jobs.events.%s", inputs.JobID))
+	configPath, err := generateNXFConfig(natsURL(cfg) != "", fmt.Sprintf("jobs.events.%s", inputs.JobID), limits, runMaxTime(ctx))
 	if err != nil {
 		return fmt.Errorf("failed to generate config: %w", err)
 	}
@@ -55,13 +89,19 @@ func Run(ctx context.Context, client *pb.Client, log *logger.LoggerWrapper, cfg
 
 	log.Debug("Preparing NXF env")
 
-	execCfg := prepareNXFEnv(cfg, paths, configPath, inputsPath, inputs)
+	execCfg := prepareNXFEnv(cfg, paths, configPath, inputsPath, inputs, sessionID)
+	// Keep the run's output where the worker can report it while the job runs.
+	if output := joblog.FromContext(ctx); output != nil {
+		execCfg.Output = output
+	}
 
 	log.Debug("Executing NXF")
 
 	localExec := local.NewLocalExecutor(log)
 	es := executor.NewExecutorService(localExec)
-	if _, err := es.Execute(ctx, execCfg); err != nil {
+	_, err = es.Execute(ctx, execCfg)
+	recordCompute(client, log, inputs.JobID, paths.TracePath)
+	if err != nil {
 		return fmt.Errorf("workflow execution failed: %w", err)
 	}
 
@@ -72,13 +112,19 @@ func Run(ctx context.Context, client *pb.Client, log *logger.LoggerWrapper, cfg
 
 func RunWithLogs(ctx context.Context, client *pb.Client, log *logger.LoggerWrapper, cfg *config.Config, inputs NextflowInputs) (<-chan string, error) {
 	log.Debug("Preparing working directories")
-	paths, err := prepareWorkingDirectories(inputs.JobID, inputs.Name)
+	paths, err := prepareWorkingDirectories(inputs.JobID, inputs.Name, inputs.Resume)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate directories: %w", err)
 	}
+	sessionID := resumeSessionID(log, inputs, paths)
+
+	limits, err := runLimits(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	log.Debug("Generating config")
-	configPath, err := generateNXFConfig(cfg.MQ.URL, fmt.Sprintf("jobs.events.%s", inputs.JobID))
+	configPath, err := generateNXFConfig(natsURL(cfg) != "", fmt.Sprintf("jobs.events.%s", inputs.JobID), limits, runMaxTime(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate config: %w", err)
 	}
@@ -90,7 +136,7 @@ func RunWithLogs(ctx context.Context, client *pb.Client, log *logger.LoggerWrapp
 	}
 
 	log.Debug("Preparing NXF env")
-	execCfg := prepareNXFEnv(cfg, paths, configPath, inputsPath, inputs)
+	execCfg := prepareNXFEnv(cfg, paths, configPath, inputsPath, inputs, sessionID)
 
 	log.Debug("Executing NXF with logs")
 	localExec := local.NewLocalExecutor(log)
@@ -105,13 +151,15 @@ func RunWithLogs(ctx context.Context, client *pb.Client, log *logger.LoggerWrapp
 		for range logChan {
 			// Simply drain the channel if no processing is needed here.
 		}
+		recordCompute(client, log, inputs.JobID, paths.TracePath)
 		log.Debug("Storing Results")
 		StoreResults(client, inputs.UserID, inputs.JobID, paths.ResultsDir)
 
 		log.Debug("Removing paths")
 		os.Remove(inputsPath)
 		os.Remove(configPath)
-		os.RemoveAll(paths.JobDir)
+		// The log stream doesn't carry the exit status, so only an interrupted run is kept for resuming.
+		finishRun(log, paths, ctx.Err() != nil)
 	}()
 
 	return logChan, nil
@@ -95,14 +95,28 @@ func sanitizeFileName(fileName string) string {
 	return strings.ReplaceAll(fileName, " ", "_")
 }
 
-func prepareWorkingDirectories(jobID, name string) (*WorkflowPaths, error) {
+// workflowsDir returns the directory that holds the directories of all runs.
+func workflowsDir() (string, error) {
 	cwd, err := os.Getwd()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get current working directory: %w", err)
+		return "", fmt.Errorf("failed to get current working directory: %w", err)
 	}
+	return filepath.Join(cwd, "pb_data", "workflows"), nil
+}
 
-	baseDir := filepath.Join(cwd, "pb_data", "workflows")
+// prepareWorkingDirectories creates the directories of a run. Unless the run resumes,
+// anything left in its job directory by a previous run is removed first.
+func prepareWorkingDirectories(jobID, name string, resume bool) (*WorkflowPaths, error) {
+	baseDir, err := workflowsDir()
+	if err != nil {
+		return nil, err
+	}
 	jobDir := filepath.Join(baseDir, jobID)
+	if !resume {
+		if err := os.RemoveAll(jobDir); err != nil {
+			return nil, fmt.Errorf("failed to clear directory %s: %w", jobDir, err)
+		}
+	}
 	inputsDir := filepath.Join(jobDir, "inputs")
 	nxfDir := filepath.Join(jobDir, "nxf")
 	logPath := filepath.Join(baseDir, "logs", fmt.Sprintf("%s.nextflow.log", jobID))
@@ -122,29 +136,42 @@ func prepareWorkingDirectories(jobID, name string) (*WorkflowPaths, error) {
 		NXFDir:     nxfDir,
 		LogPath:    logPath,
 		ResultsDir: resultsDir,
+		TracePath:  filepath.Join(jobDir, "trace.txt"),
 	}, nil
 }
 
-func prepareNXFEnv(cfg *config.Config, paths *WorkflowPaths, configPath, inputsPath string, inputs NextflowInputs) *local.LocalConfig {
+// prepareNXFEnv builds the Nextflow command of a run. Runs are launched from their job
+// directory, which keeps each run's history, and so its session, apart. A non-empty
+// sessionID resumes that session, reusing the tasks it completed.
+func prepareNXFEnv(cfg *config.Config, paths *WorkflowPaths, configPath, inputsPath string, inputs NextflowInputs, sessionID string) *local.LocalConfig {
+	args := []string{
+		fmt.Sprintf("%s/nextflow", paths.BaseDir),
+		"-log", paths.LogPath,
+		"run", inputs.Repository,
+		"-latest",
+		"-c", configPath,
+		"-params-file", inputsPath,
+		"-with-trace", paths.TracePath,
+		"--outdir", paths.ResultsDir,
+	}
+	if sessionID != "" {
+		args = append(args, "-resume", sessionID)
+	}
+	env := []string{
+		"NXF_HOME=" + paths.NXFDir,
+		"NXF_ASSETS=" + filepath.Join(paths.BaseDir, "assets"),
+		"NXF_PLUGINS_DIR=" + filepath.Join(paths.BaseDir, "plugins"),
+		"NXF_WORK=" + filepath.Join(paths.NXFDir, "work"),
+		"NXF_TEMP=" + filepath.Join(paths.NXFDir, "tmp"),
+		"NXF_CACHE_DIR=" + filepath.Join(paths.NXFDir, "cache"),
+		"NXF_PLUGINS_TEST_REPOSITORY=" + cfg.NXF.PluginsTestRepository,
+	}
+	if url := natsURL(cfg); url != "" {
+		env = append(env, natsURLEnv+"="+url)
+	}
 	return local.NewLocalConfig(
-		[]string{
-			fmt.Sprintf("%s/nextflow", paths.BaseDir),
-			"-log", paths.LogPath,
-			"run", inputs.Repository,
-			"-latest",
-			"-c", configPath,
-			"-params-file", inputsPath,
-			"--outdir", paths.ResultsDir,
-		},
-		local.WithWorkingDir(paths.BaseDir),
-		local.WithEnv([]string{
-			"NXF_HOME=" + paths.NXFDir,
-			"NXF_ASSETS=" + filepath.Join(paths.BaseDir, "assets"),
-			"NXF_PLUGINS_DIR=" + filepath.Join(paths.BaseDir, "plugins"),
-			"NXF_WORK=" + filepath.Join(paths.NXFDir, "work"),
-			"NXF_TEMP=" + filepath.Join(paths.NXFDir, "tmp"),
-			"NXF_CACHE_DIR=" + filepath.Join(paths.NXFDir, "cache"),
-			"NXF_PLUGINS_TEST_REPOSITORY=" + cfg.NXF.PluginsTestRepository,
-		}),
+		args,
+		local.WithWorkingDir(paths.JobDir),
+		local.WithEnv(env),
 	)
 }
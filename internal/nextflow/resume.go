@@ -0,0 +1,108 @@
+package nextflow
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aligndx/aligndx/internal/logger"
+)
+
+// retainedMarker is written to the directory of a failed run. Its modification time
+// records when the run failed, which the retention policy counts from.
+const retainedMarker = ".retained"
+
+var sessionIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// lastSessionID returns the session ID of the latest run launched from a job directory,
+// read from the history Nextflow keeps in the launch directory.
+func lastSessionID(jobDir string) (string, error) {
+	file, err := os.Open(filepath.Join(jobDir, ".nextflow", "history"))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var sessionID string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		for _, field := range strings.Split(scanner.Text(), "\t") {
+			if sessionIDPattern.MatchString(field) {
+				sessionID = field
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if sessionID == "" {
+		return "", fmt.Errorf("no session recorded in %s", jobDir)
+	}
+	return sessionID, nil
+}
+
+// resumeSessionID returns the session to resume for a run, or "" to start from scratch.
+func resumeSessionID(log *logger.LoggerWrapper, inputs NextflowInputs, paths *WorkflowPaths) string {
+	if !inputs.Resume {
+		return ""
+	}
+	sessionID, err := lastSessionID(paths.JobDir)
+	if err != nil {
+		log.Warn("Nothing to resume, starting the run from scratch", map[string]interface{}{
+			"job_id": inputs.JobID,
+			"error":  err.Error(),
+		})
+		return ""
+	}
+	os.Remove(filepath.Join(paths.JobDir, retainedMarker))
+	return sessionID
+}
+
+// finishRun removes the directory of a successful run. The directory of a failed run is
+// kept, with its work directory and session, so the run can be resumed.
+func finishRun(log *logger.LoggerWrapper, paths *WorkflowPaths, failed bool) {
+	if !failed {
+		os.RemoveAll(paths.JobDir)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(paths.JobDir, retainedMarker), nil, 0666); err != nil {
+		log.Error("Failed to mark run for retention", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// CleanupRetained removes the directories of failed runs that have not been resumed
+// within retainFor, and returns the removed directories.
+func CleanupRetained(retainFor time.Duration) ([]string, error) {
+	baseDir, err := workflowsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var removed []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		jobDir := filepath.Join(baseDir, entry.Name())
+		marker, err := os.Stat(filepath.Join(jobDir, retainedMarker))
+		if err != nil || time.Since(marker.ModTime()) < retainFor {
+			continue
+		}
+		if err := os.RemoveAll(jobDir); err != nil {
+			return removed, err
+		}
+		removed = append(removed, jobDir)
+	}
+	return removed, nil
+}
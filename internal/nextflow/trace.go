@@ -0,0 +1,105 @@
+package nextflow
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/aligndx/aligndx/internal/logger"
+	pb "github.com/aligndx/aligndx/internal/pb/client"
+)
+
+// Compute summarises the compute a run used, as recorded in its Nextflow trace. Tasks reused
+// by a resumed run are counted with the compute they used when they first ran.
+type Compute struct {
+	CPUHours        float64 `json:"cpu_hours"`         // Sum over tasks of their CPUs times their run time
+	PeakMemoryBytes int64   `json:"peak_memory_bytes"` // Largest resident memory of any task
+	Tasks           int     `json:"tasks"`
+	Completed       int     `json:"completed"`
+	Failed          int     `json:"failed"`
+	Cached          int     `json:"cached"`
+}
+
+// Task statuses recorded in the trace.
+const (
+	traceCompleted = "COMPLETED"
+	traceCached    = "CACHED"
+	traceFailed    = "FAILED"
+	traceAborted   = "ABORTED"
+)
+
+// parseTrace reads a raw Nextflow trace, in which times are in milliseconds and memory in bytes.
+func parseTrace(r io.Reader) (Compute, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = '\t'
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return Compute{}, fmt.Errorf("failed to read trace header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	var compute Compute
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Compute{}, fmt.Errorf("failed to read trace: %w", err)
+		}
+
+		compute.Tasks++
+		switch field(row, "status") {
+		case traceCompleted:
+			compute.Completed++
+		case traceCached:
+			compute.Cached++
+		case traceFailed, traceAborted:
+			compute.Failed++
+		}
+
+		// Missing values are recorded as "-" and count as zero.
+		realtime, _ := strconv.ParseFloat(field(row, "realtime"), 64)
+		cpus, _ := strconv.ParseFloat(field(row, "cpus"), 64)
+		compute.CPUHours += max(cpus, 1) * realtime / 3.6e6
+		if rss, err := strconv.ParseInt(field(row, "peak_rss"), 10, 64); err == nil && rss > compute.PeakMemoryBytes {
+			compute.PeakMemoryBytes = rss
+		}
+	}
+	return compute, nil
+}
+
+// recordCompute stores the compute summary of a run's trace on its submission. A run that
+// failed still used compute, so it is recorded whether or not the run succeeded.
+func recordCompute(client *pb.Client, log *logger.LoggerWrapper, submissionID, tracePath string) {
+	file, err := os.Open(tracePath)
+	if err != nil {
+		log.Warn("No trace to record compute from", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	compute, err := parseTrace(file)
+	if err != nil {
+		log.Error("Failed to parse trace", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if _, err := client.UpdateRecord("submissions", submissionID, map[string]any{"compute": compute}, nil, nil); err != nil {
+		log.Error("Failed to record compute", map[string]interface{}{"error": err.Error()})
+	}
+}
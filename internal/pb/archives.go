@@ -0,0 +1,59 @@
+package pb
+
+import (
+	"context"
+
+	"github.com/aligndx/aligndx/internal/jobs"
+	"github.com/aligndx/aligndx/internal/jobs/handlers/archive"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// bindArchives queues the extraction of archives uploaded to the data collection. The
+// status of the extraction job is kept on the archive's record.
+func bindArchives(ctx context.Context, pb *pocketbase.PocketBase, jobService jobs.JobServiceInterface) {
+	pb.OnRecordCreateRequest("data").BindFunc(func(e *core.RecordRequestEvent) error {
+		e.Record.Set("status", "")
+		e.Record.Set("status_reason", "")
+		if e.Record.GetString("type") == "archive" {
+			e.Record.Set("status", string(jobs.StatusQueued))
+		}
+		return e.Next()
+	})
+
+	pb.OnRecordAfterCreateSuccess("data").BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.GetString("type") != "archive" {
+			return e.Next()
+		}
+
+		inputs := archive.ArchiveInputs{DataID: e.Record.Id}
+		if users := e.Record.GetStringSlice("user"); len(users) > 0 {
+			inputs.UserID = users[0]
+		}
+		if err := jobService.Queue(ctx, e.Record.Id, inputs, "archive", jobs.WithUser(inputs.UserID)); err != nil {
+			// The upload itself succeeded, so record why the archive won't be extracted.
+			e.Record.Set("status", string(jobs.StatusError))
+			e.Record.Set("status_reason", err.Error())
+			if err := e.App.Save(e.Record); err != nil {
+				return err
+			}
+		}
+		return e.Next()
+	})
+}
+
+// setArchiveStatus records a status reported on the event stream if it belongs to the
+// extraction of an archive, and reports whether it did.
+func setArchiveStatus(app core.App, event jobs.StatusEventMetadata) (bool, error) {
+	record, err := app.FindRecordById("data", event.JobID)
+	if err != nil || record.GetString("type") != "archive" {
+		return false, nil
+	}
+	if current := jobs.JobStatus(record.GetString("status")); !current.CanTransitionTo(event.Status) {
+		app.Logger().Warn("Rejecting illegal status transition", "data", record.Id, "from", current, "to", event.Status)
+		return true, nil
+	}
+	record.Set("status", string(event.Status))
+	record.Set("status_reason", event.Reason)
+	return true, app.Save(record)
+}
@@ -0,0 +1,222 @@
+package pb
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aligndx/aligndx/internal/jobs"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// batchRequest is the body of a batch submission.
+type batchRequest struct {
+	Workflow string                 `json:"workflow"`
+	Name     string                 `json:"name"`
+	Params   map[string]interface{} `json:"params"`   // Parameters shared by every sample
+	Priority string                 `json:"priority"` // Priority of every submission in the batch
+	Sheet    string                 `json:"sheet"`    // CSV or TSV sample sheet
+}
+
+// sampleRow is one row of a sample sheet: a sample name and the data record IDs of each input.
+type sampleRow struct {
+	Sample string
+	Inputs map[string][]string
+}
+
+// parseSampleSheet parses a CSV or TSV sample sheet. The header must start with a "sample"
+// column; every other column names an input, and its cells hold data record IDs separated by ";".
+func parseSampleSheet(sheet string) ([]sampleRow, error) {
+	r := csv.NewReader(strings.NewReader(sheet))
+	firstLine, _, _ := strings.Cut(sheet, "\n")
+	if strings.Contains(firstLine, "\t") {
+		r.Comma = '\t'
+	}
+	r.TrimLeadingSpace = true
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid sample sheet: %w", err)
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("sample sheet needs a header and at least one sample")
+	}
+	header := records[0]
+	if len(header) < 2 || !strings.EqualFold(strings.TrimSpace(header[0]), "sample") {
+		return nil, fmt.Errorf("sample sheet header must be \"sample\" followed by input columns")
+	}
+
+	rows := make([]sampleRow, 0, len(records)-1)
+	seen := make(map[string]struct{})
+	for _, record := range records[1:] {
+		sample := strings.TrimSpace(record[0])
+		if sample == "" {
+			return nil, fmt.Errorf("sample sheet has a row without a sample name")
+		}
+		if _, ok := seen[sample]; ok {
+			return nil, fmt.Errorf("sample %s appears more than once", sample)
+		}
+		seen[sample] = struct{}{}
+
+		row := sampleRow{Sample: sample, Inputs: make(map[string][]string)}
+		for i, cell := range record[1:] {
+			column := strings.TrimSpace(header[i+1])
+			for _, id := range strings.Split(cell, ";") {
+				if id = strings.TrimSpace(id); id != "" {
+					row.Inputs[column] = append(row.Inputs[column], id)
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// batchHandler creates a batch and one submission per sample sheet row for the authenticated user.
+// Every row is validated before anything is created, as the submissions are saved without the
+// checks of the create request.
+func batchHandler(e *core.RequestEvent, jobService jobs.JobServiceInterface) error {
+	var req batchRequest
+	if err := e.BindBody(&req); err != nil {
+		return e.BadRequestError("Invalid batch request", err)
+	}
+	if req.Workflow == "" || req.Sheet == "" {
+		return e.BadRequestError("workflow and sheet are required", nil)
+	}
+	if req.Priority != "" && string(jobs.ParsePriority(req.Priority)) != req.Priority {
+		return e.BadRequestError(fmt.Sprintf("Unknown priority %q, expected one of %v", req.Priority, jobs.Priorities), nil)
+	}
+	rows, err := parseSampleSheet(req.Sheet)
+	if err != nil {
+		return e.BadRequestError(err.Error(), nil)
+	}
+
+	userID := e.Auth.Id
+	workflowRecord, err := e.App.FindRecordById("workflows", req.Workflow)
+	if err != nil {
+		return e.BadRequestError("Unknown workflow", err)
+	}
+	for _, row := range rows {
+		for _, ids := range row.Inputs {
+			for _, id := range ids {
+				data, err := e.App.FindRecordById("data", id)
+				if err != nil || !slices.Contains(data.GetStringSlice("user"), userID) {
+					return e.BadRequestError(fmt.Sprintf("Sample %s: unknown data record %s", row.Sample, id), err)
+				}
+			}
+		}
+	}
+
+	name := req.Name
+	if name == "" {
+		name = fmt.Sprintf("%s %s", workflowRecord.GetString("name"), time.Now().UTC().Format("2006-01-02 15:04"))
+	}
+
+	submissions, err := e.App.FindCollectionByNameOrId("submissions")
+	if err != nil {
+		return e.InternalServerError("Failed to create batch", err)
+	}
+	records := make([]*core.Record, 0, len(rows))
+	for i, row := range rows {
+		params := make(map[string]interface{}, len(req.Params)+len(row.Inputs))
+		for key, value := range req.Params {
+			params[key] = value
+		}
+		for key, ids := range row.Inputs {
+			params[key] = ids
+		}
+
+		submission := core.NewRecord(submissions)
+		submission.Set("user", userID)
+		submission.Set("workflow", workflowRecord.Id)
+		submission.Set("name", fmt.Sprintf("%s %s", name, row.Sample))
+		submission.Set("params", params)
+		submission.Set("status", string(jobs.StatusCreated))
+		submission.Set("priority", req.Priority)
+
+		inputs, err := submissionInputs(submission, workflowRecord)
+		if err == nil {
+			err = jobService.Validate("workflow", inputs)
+		}
+		if err != nil {
+			return e.BadRequestError(fmt.Sprintf("Row %d (sample %s): %v", i+1, row.Sample, err), err)
+		}
+		records = append(records, submission)
+	}
+
+	var batchID string
+	submissionIDs := make([]string, 0, len(rows))
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		batches, err := txApp.FindCollectionByNameOrId("batches")
+		if err != nil {
+			return err
+		}
+		batch := core.NewRecord(batches)
+		batch.Set("user", userID)
+		batch.Set("workflow", workflowRecord.Id)
+		batch.Set("name", name)
+		batch.Set("params", req.Params)
+		batch.Set("total", len(rows))
+		batch.Set("counts", map[string]int{string(jobs.StatusCreated): len(rows)})
+		batch.Set("status", "running")
+		if err := txApp.Save(batch); err != nil {
+			return err
+		}
+		batchID = batch.Id
+
+		for i, submission := range records {
+			submission.Set("batch", batchID)
+			if err := txApp.Save(submission); err != nil {
+				return fmt.Errorf("failed to create submission for sample %s: %w", rows[i].Sample, err)
+			}
+			submissionIDs = append(submissionIDs, submission.Id)
+		}
+		return nil
+	})
+	if err != nil {
+		return e.InternalServerError("Failed to create batch", err)
+	}
+
+	return e.JSON(http.StatusCreated, map[string]interface{}{"batch": batchID, "submissions": submissionIDs})
+}
+
+// updateBatch recomputes a batch's status counts from its submissions. A batch is running
+// until every submission has finished, then completed or failed.
+func updateBatch(app core.App, batchID string) error {
+	batch, err := app.FindRecordById("batches", batchID)
+	if err != nil {
+		return err
+	}
+	submissions, err := app.FindAllRecords("submissions", dbx.HashExp{"batch": batchID})
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	finished, failed := 0, 0
+	for _, submission := range submissions {
+		status := jobs.JobStatus(submission.GetString("status"))
+		counts[string(status)]++
+		if status.IsTerminal() {
+			finished++
+			if status != jobs.StatusCompleted {
+				failed++
+			}
+		}
+	}
+
+	status := "running"
+	if finished == len(submissions) {
+		status = "completed"
+		if failed > 0 {
+			status = "failed"
+		}
+	}
+	batch.Set("counts", counts)
+	batch.Set("status", status)
+	return app.Save(batch)
+}
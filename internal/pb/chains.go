@@ -0,0 +1,171 @@
+package pb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/aligndx/aligndx/internal/jobs"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// dependencyMu serialises starting dependent submissions, so a child created while its
+// parent finishes is started exactly once.
+var dependencyMu sync.Mutex
+
+// startDependent queues a submission whose parent has completed, fails it if the parent
+// did not complete, and otherwise leaves it waiting for the parent.
+func startDependent(ctx context.Context, app core.App, jobService jobs.JobServiceInterface, child *core.Record) error {
+	dependencyMu.Lock()
+	defer dependencyMu.Unlock()
+	return startDependentLocked(ctx, app, jobService, child)
+}
+
+// startDependentLocked is startDependent for callers holding dependencyMu. The parent's status
+// is read under the lock, so a parent finishing concurrently either is seen here or finds the
+// child waiting when it releases its dependents.
+func startDependentLocked(ctx context.Context, app core.App, jobService jobs.JobServiceInterface, child *core.Record) error {
+	parent, err := app.FindRecordById("submissions", child.GetString("depends_on"))
+	if err != nil {
+		return failDependent(ctx, app, jobService, child, "parent submission not found")
+	}
+
+	parentStatus := jobs.JobStatus(parent.GetString("status"))
+	switch {
+	case parentStatus == jobs.StatusCompleted:
+		params, err := dependentParams(app, parent, child)
+		if err != nil {
+			return failDependent(ctx, app, jobService, child, err.Error())
+		}
+		child.Set("params", params)
+		// Dependent inputs are only known now, so they are validated here rather than on create.
+		workflowInputs, opts, err := submissionJob(app, child)
+		if err != nil {
+			return failDependent(ctx, app, jobService, child, err.Error())
+		}
+		if err := jobService.Validate("workflow", workflowInputs); err != nil {
+			return failDependent(ctx, app, jobService, child, err.Error())
+		}
+		child.Set("status", string(jobs.StatusQueued))
+		if err := saveDependent(app, child, "params", "status"); err != nil {
+			return err
+		}
+		if err := jobService.Queue(ctx, child.Id, workflowInputs, "workflow", opts...); err != nil {
+			if failErr := failDependent(ctx, app, jobService, child, fmt.Sprintf("failed to queue: %v", err)); failErr != nil {
+				return errors.Join(err, failErr)
+			}
+			return err
+		}
+		return nil
+	case parentStatus.IsTerminal():
+		return failDependent(ctx, app, jobService, child, fmt.Sprintf("parent submission %s ended with status %s", parent.Id, parentStatus))
+	default:
+		child.Set("status", string(jobs.StatusWaiting))
+		return saveDependent(app, child, "status")
+	}
+}
+
+// failDependent marks a dependent submission as failed with the given reason.
+func failDependent(ctx context.Context, app core.App, jobService jobs.JobServiceInterface, child *core.Record, reason string) error {
+	child.Set("status", string(jobs.StatusError))
+	if err := saveDependent(app, child, "status"); err != nil {
+		return err
+	}
+	return jobService.UpdateStatus(ctx, child.Id, jobs.StatusError, reason)
+}
+
+// saveDependent writes only the given fields of a dependent submission. It takes submissionMu,
+// so the write is ordered with the event consumers' updates of the same record.
+func saveDependent(app core.App, child *core.Record, fields ...string) error {
+	submissionMu.Lock()
+	defer submissionMu.Unlock()
+	return saveSubmissionFields(app, child, fields...)
+}
+
+// releaseDependents starts or fails the submissions waiting on a parent that has finished.
+func releaseDependents(ctx context.Context, app core.App, jobService jobs.JobServiceInterface, parentID string) {
+	// The lock covers the query, so a child deciding to wait on this parent is either found
+	// here or sees the parent's final status.
+	dependencyMu.Lock()
+	defer dependencyMu.Unlock()
+
+	children, err := app.FindAllRecords("submissions", dbx.HashExp{
+		"depends_on": parentID,
+		"status":     string(jobs.StatusWaiting),
+	})
+	if err != nil {
+		app.Logger().Error("Failed to find dependent submissions", "parent", parentID, "error", err)
+		return
+	}
+	for _, child := range children {
+		if err := startDependentLocked(ctx, app, jobService, child); err != nil {
+			app.Logger().Error("Failed to start dependent submission", "submission", child.Id, "error", err)
+		}
+	}
+}
+
+// dependentParams returns a child's parameters with each mapped input set to the IDs of
+// the parent output files matching its pattern. A pattern containing a slash is matched
+// against the file's path in the output tree, any other pattern against its name.
+func dependentParams(app core.App, parent *core.Record, child *core.Record) (map[string]interface{}, error) {
+	params := map[string]interface{}{}
+	if raw := child.GetString("params"); raw != "" && raw != "null" {
+		if err := child.UnmarshalJSONField("params", &params); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+	mapping := map[string]string{}
+	if raw := child.GetString("input_mapping"); raw != "" && raw != "null" {
+		if err := child.UnmarshalJSONField("input_mapping", &mapping); err != nil {
+			return nil, fmt.Errorf("invalid input mapping: %w", err)
+		}
+	}
+	if len(mapping) == 0 {
+		return params, nil
+	}
+
+	outputs, err := app.FindAllRecords("data", dbx.HashExp{"submission": parent.Id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load outputs of %s: %w", parent.Id, err)
+	}
+	byID := make(map[string]*core.Record, len(outputs))
+	for _, record := range outputs {
+		byID[record.Id] = record
+	}
+
+	for field, pattern := range mapping {
+		var ids []string
+		for _, record := range outputs {
+			if record.GetString("type") != "file" {
+				continue
+			}
+			target := record.GetString("name")
+			if strings.Contains(pattern, "/") {
+				target = outputPath(record, byID)
+			}
+			if ok, err := path.Match(pattern, target); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q for input %s: %w", pattern, field, err)
+			} else if ok {
+				ids = append(ids, record.Id)
+			}
+		}
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("no output of %s matches %q for input %s", parent.Id, pattern, field)
+		}
+		params[field] = ids
+	}
+	return params, nil
+}
+
+// outputPath returns the path of an output record within its submission's output tree.
+func outputPath(record *core.Record, byID map[string]*core.Record) string {
+	parts := []string{record.GetString("name")}
+	for parent, ok := byID[record.GetString("parent")]; ok; parent, ok = byID[parent.GetString("parent")] {
+		parts = append([]string{parent.GetString("name")}, parts...)
+	}
+	return strings.Join(parts, "/")
+}
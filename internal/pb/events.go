@@ -0,0 +1,131 @@
+package pb
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/aligndx/aligndx/internal/jobs"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// submissionMu serialises the read-modify-write updates that event consumers make to
+// submission records, so concurrent saves don't drop each other's changes.
+var submissionMu sync.Mutex
+
+// saveSubmissionFields writes only the given fields of a submission, so a consumer does not
+// overwrite fields saved through the API since it read the record, such as outputs. The
+// update is then announced like a regular save, so realtime subscribers still receive it.
+func saveSubmissionFields(app core.App, record *core.Record, fields ...string) error {
+	record.Set("updated", types.NowDateTime())
+	exported, err := record.DBExport(app)
+	if err != nil {
+		return err
+	}
+	params := dbx.Params{"updated": exported["updated"]}
+	for _, field := range fields {
+		params[field] = exported[field]
+	}
+	if _, err := app.NonconcurrentDB().Update(record.TableName(), params, dbx.HashExp{"id": record.Id}).Execute(); err != nil {
+		return err
+	}
+
+	saved, err := app.FindRecordById(record.Collection(), record.Id)
+	if err != nil {
+		return err
+	}
+	event := &core.ModelEvent{App: app, Context: context.Background(), Type: core.ModelEventTypeUpdate}
+	event.Model = saved
+	return app.OnModelAfterUpdateSuccess().Trigger(event)
+}
+
+// bindEventRecorder persists every job event into the events collection, linked to its
+// submission, so history outlives the EVENTS stream's MaxAge.
+func bindEventRecorder(ctx context.Context, app core.App, jobService jobs.JobServiceInterface) error {
+	return jobService.Subscribe(ctx, ">", "job-event-recorder", func(msg jetstream.Msg) {
+		if err := recordEvent(app, msg); err != nil {
+			app.Logger().Error(err.Error(), "subject", msg.Subject())
+		}
+	})
+}
+
+// recordEvent stores a single event message. Messages are identified by their stream
+// sequence and publish time, so redeliveries are skipped while events published after
+// a stream reset, which restarts sequences, are still recorded.
+func recordEvent(app core.App, msg jetstream.Msg) error {
+	meta, err := msg.Metadata()
+	if err != nil {
+		return err
+	}
+	published, err := types.ParseDateTime(meta.Timestamp)
+	if err != nil {
+		return err
+	}
+
+	existing, _ := app.FindFirstRecordByFilter("events",
+		"stream_seq = {:seq} && published = {:published}",
+		dbx.Params{"seq": meta.Sequence.Stream, "published": published.String()},
+	)
+	if existing != nil {
+		return nil
+	}
+
+	var event jobs.Event[json.RawMessage]
+	if err := json.Unmarshal(msg.Data(), &event); err != nil {
+		return err
+	}
+
+	submission, err := app.FindRecordById("submissions", eventJobID(msg.Subject(), event.MetaData))
+	if err != nil {
+		// Events of deleted or unknown submissions are not kept.
+		return nil
+	}
+
+	collection, err := app.FindCollectionByNameOrId("events")
+	if err != nil {
+		return err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("type", event.Type)
+	record.Set("message", event.Message)
+	record.Set("metadata", event.MetaData)
+	record.Set("timestamp", event.TimeStamp)
+	record.Set("submission", submission.Id)
+	record.Set("subject", msg.Subject())
+	record.Set("stream_seq", meta.Sequence.Stream)
+	record.Set("published", published)
+	return app.Save(record)
+}
+
+// eventJobID returns the job an event belongs to: the jobid in its metadata if it has one,
+// otherwise the job ID in its subject.
+func eventJobID(subject string, metadata json.RawMessage) string {
+	var ids struct {
+		JobID string `json:"jobid"`
+	}
+	if err := json.Unmarshal(metadata, &ids); err == nil && ids.JobID != "" {
+		return ids.JobID
+	}
+	return subjectJobID(subject)
+}
+
+// jobEventKinds are the events published to <prefix>.events.<kind>.<jobId>; every other
+// event is published to <prefix>.events.<jobId>.<event...>.
+var jobEventKinds = map[string]bool{"status": true, "cancel": true, "attempt": true}
+
+// subjectJobID extracts the job ID from an event subject.
+func subjectJobID(subject string) string {
+	tokens := strings.Split(subject, ".")
+	if len(tokens) < 3 {
+		return ""
+	}
+	if jobEventKinds[tokens[2]] && len(tokens) > 3 {
+		return tokens[3]
+	}
+	return tokens[2]
+}
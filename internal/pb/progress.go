@@ -0,0 +1,130 @@
+package pb
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/aligndx/aligndx/internal/jobs"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// submissionProgress is stored in a submission's progress field: the summary shown
+// to users along with the task states it is computed from.
+type submissionProgress struct {
+	jobs.Progress
+	Tasks map[string]jobs.TaskState `json:"tasks"`
+}
+
+// progressFlushInterval is how often buffered process events are applied to their submissions.
+const progressFlushInterval = 2 * time.Second
+
+// progressBuffer collects process events per submission between flushes, so a busy run
+// saves its submission and publishes its progress once per interval rather than per task event.
+type progressBuffer struct {
+	mu     sync.Mutex
+	events map[string][]jobs.Event[jobs.TaskEventMetadata]
+}
+
+func (b *progressBuffer) add(jobID string, event jobs.Event[jobs.TaskEventMetadata]) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events[jobID] = append(b.events[jobID], event)
+}
+
+// take returns the buffered events and empties the buffer.
+func (b *progressBuffer) take() map[string][]jobs.Event[jobs.TaskEventMetadata] {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	events := b.events
+	b.events = make(map[string][]jobs.Event[jobs.TaskEventMetadata])
+	return events
+}
+
+// bindProgress consumes the process events published by the nf-nats plugin, keeps
+// each submission's progress up to date and republishes the processes that changed as
+// a job.progress event. Events are applied in batches every progressFlushInterval.
+func bindProgress(ctx context.Context, app core.App, jobService jobs.JobServiceInterface) error {
+	buffer := &progressBuffer{events: make(map[string][]jobs.Event[jobs.TaskEventMetadata])}
+	go func() {
+		ticker := time.NewTicker(progressFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				flushProgress(ctx, app, jobService, buffer.take())
+			case <-ctx.Done():
+				// Apply what is left, so finished tasks are not lost on shutdown.
+				flushProgress(context.WithoutCancel(ctx), app, jobService, buffer.take())
+				return
+			}
+		}
+	}()
+
+	return jobService.Subscribe(ctx, "*.process.>", "job-progress-tracker", func(msg jetstream.Msg) {
+		var event jobs.Event[jobs.TaskEventMetadata]
+		if err := json.Unmarshal(msg.Data(), &event); err != nil {
+			app.Logger().Error(err.Error())
+			return
+		}
+		buffer.add(subjectJobID(msg.Subject()), event)
+	})
+}
+
+// flushProgress applies buffered process events to their submissions and publishes the changes.
+func flushProgress(ctx context.Context, app core.App, jobService jobs.JobServiceInterface, events map[string][]jobs.Event[jobs.TaskEventMetadata]) {
+	for jobID, batch := range events {
+		progress, changed, err := recordProgress(app, jobID, batch)
+		if err != nil {
+			app.Logger().Error(err.Error(), "submission", jobID)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := jobService.PublishProgress(ctx, jobID, progress); err != nil {
+			app.Logger().Error(err.Error(), "submission", jobID)
+		}
+	}
+}
+
+// recordProgress applies process events to the stored progress of a submission. It reports
+// whether the progress changed and returns it with only the processes whose counts changed.
+func recordProgress(app core.App, jobID string, events []jobs.Event[jobs.TaskEventMetadata]) (jobs.Progress, bool, error) {
+	submissionMu.Lock()
+	defer submissionMu.Unlock()
+
+	record, err := app.FindRecordById("submissions", jobID)
+	if err != nil {
+		return jobs.Progress{}, false, err
+	}
+
+	var stored submissionProgress
+	if err := record.UnmarshalJSONField("progress", &stored); err != nil || stored.Tasks == nil {
+		stored.Tasks = make(map[string]jobs.TaskState)
+	}
+	previous := jobs.SummarizeProgress(stored.Tasks)
+	for _, event := range events {
+		jobs.ApplyTaskEvent(stored.Tasks, event)
+	}
+	stored.Progress = jobs.SummarizeProgress(stored.Tasks)
+
+	update := stored.Progress
+	update.Processes = make(map[string]jobs.ProcessProgress)
+	for process, counts := range stored.Progress.Processes {
+		if previous.Processes[process] != counts {
+			update.Processes[process] = counts
+		}
+	}
+	if len(update.Processes) == 0 && update.ProcessProgress == previous.ProcessProgress {
+		return update, false, nil
+	}
+
+	record.Set("progress", stored)
+	if err := saveSubmissionFields(app, record, "progress"); err != nil {
+		return jobs.Progress{}, false, err
+	}
+	return update, true, nil
+}
@@ -0,0 +1,96 @@
+package pb
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/aligndx/aligndx/internal/jobs"
+	"github.com/aligndx/aligndx/internal/nextflow"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// computeUsage is the compute used by a group of finished submissions.
+type computeUsage struct {
+	Group           string  `json:"group"`
+	Submissions     int     `json:"submissions"`
+	Completed       int     `json:"completed"`
+	Failed          int     `json:"failed"`
+	CPUHours        float64 `json:"cpu_hours"`
+	PeakMemoryBytes int64   `json:"peak_memory_bytes"`
+	RunHours        float64 `json:"run_hours"`   // Time between starting and finishing
+	QueueHours      float64 `json:"queue_hours"` // Time between being queued and starting
+}
+
+// computeReportHandler reports the compute used by submissions that finished in a period,
+// grouped by user or by workflow. The period is given by the from and to query parameters,
+// and the grouping by group_by, which defaults to user.
+func computeReportHandler(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+	groupBy := query.Get("group_by")
+	if groupBy == "" {
+		groupBy = "user"
+	}
+	if groupBy != "user" && groupBy != "workflow" {
+		return e.BadRequestError("group_by must be user or workflow", nil)
+	}
+
+	filter := "finished_at != ''"
+	params := dbx.Params{}
+	for _, bound := range []struct{ param, op string }{{"from", ">="}, {"to", "<"}} {
+		raw := query.Get(bound.param)
+		if raw == "" {
+			continue
+		}
+		at, err := types.ParseDateTime(raw)
+		if err != nil || at.IsZero() {
+			return e.BadRequestError("Invalid "+bound.param+" date", err)
+		}
+		filter += " && finished_at " + bound.op + " {:" + bound.param + "}"
+		params[bound.param] = at.String()
+	}
+
+	records, err := e.App.FindRecordsByFilter("submissions", filter, "finished_at", 0, 0, params)
+	if err != nil {
+		return e.InternalServerError("Failed to find submissions", err)
+	}
+
+	groups := make(map[string]*computeUsage)
+	for _, record := range records {
+		key := record.GetString(groupBy)
+		usage, ok := groups[key]
+		if !ok {
+			usage = &computeUsage{Group: key}
+			groups[key] = usage
+		}
+
+		usage.Submissions++
+		if jobs.JobStatus(record.GetString("status")) == jobs.StatusCompleted {
+			usage.Completed++
+		} else {
+			usage.Failed++
+		}
+
+		var compute nextflow.Compute
+		if err := record.UnmarshalJSONField("compute", &compute); err == nil {
+			usage.CPUHours += compute.CPUHours
+			usage.PeakMemoryBytes = max(usage.PeakMemoryBytes, compute.PeakMemoryBytes)
+		}
+
+		queued, started, finished := record.GetDateTime("queued_at"), record.GetDateTime("started_at"), record.GetDateTime("finished_at")
+		if !started.IsZero() {
+			usage.RunHours += finished.Time().Sub(started.Time()).Hours()
+			if !queued.IsZero() {
+				usage.QueueHours += started.Time().Sub(queued.Time()).Hours()
+			}
+		}
+	}
+
+	report := make([]*computeUsage, 0, len(groups))
+	for _, usage := range groups {
+		report = append(report, usage)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].CPUHours > report[j].CPUHours })
+	return e.JSON(http.StatusOK, report)
+}
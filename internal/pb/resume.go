@@ -0,0 +1,81 @@
+package pb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aligndx/aligndx/internal/jobs"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// resumable reports whether a submission in the given status can be resumed.
+func resumable(status jobs.JobStatus) bool {
+	switch status {
+	// A lost job is still pending in the queue and will be redelivered, so resuming it would run it twice.
+	case jobs.StatusError, jobs.StatusCancelled, jobs.StatusTimeout:
+		return true
+	}
+	return false
+}
+
+// resumedFields are the submission fields a resume resets.
+var resumedFields = []string{"progress", "status", "queued_at", "started_at", "finished_at", "worker"}
+
+// resumeHandler requeues a failed or cancelled submission owned by the authenticated user.
+// The run resumes from the work its previous run left behind, so completed tasks are reused.
+func resumeHandler(ctx context.Context, e *core.RequestEvent, jobService jobs.JobServiceInterface) error {
+	jobID := e.Request.PathValue("jobId")
+
+	submissionMu.Lock()
+	defer submissionMu.Unlock()
+
+	record, err := e.App.FindRecordById("submissions", jobID)
+	if err != nil {
+		return e.NotFoundError("Submission not found", err)
+	}
+	if !e.HasSuperuserAuth() && record.GetString("user") != e.Auth.Id {
+		return e.ForbiddenError("Only the submission owner can resume it", nil)
+	}
+
+	status := jobs.JobStatus(record.GetString("status"))
+	if !resumable(status) {
+		return e.BadRequestError(fmt.Sprintf("A %s submission cannot be resumed", status), nil)
+	}
+
+	workflowInputs, opts, err := submissionJob(e.App, record)
+	if err != nil {
+		return e.InternalServerError("Failed to prepare submission", err)
+	}
+	workflowInputs.Resume = true
+	// The job keeps its ID, so it needs a fresh deduplication ID to be queued again.
+	opts = append(opts, jobs.WithDeduplicationID(fmt.Sprintf("%s-resume-%d", jobID, time.Now().UnixNano())))
+
+	// The submission is restored if the job cannot be queued.
+	previous := make(map[string]any, len(resumedFields))
+	for _, field := range resumedFields {
+		previous[field] = record.Get(field)
+	}
+
+	// Task numbering restarts with the resumed run.
+	record.Set("progress", nil)
+	record.Set("status", string(jobs.StatusQueued))
+	resetTiming(record, types.NowDateTime())
+	if err := e.App.Save(record); err != nil {
+		return e.InternalServerError("Failed to update submission", err)
+	}
+
+	if err := jobService.Queue(ctx, jobID, workflowInputs, "workflow", opts...); err != nil {
+		for field, value := range previous {
+			record.Set(field, value)
+		}
+		if saveErr := e.App.Save(record); saveErr != nil {
+			e.App.Logger().Error("Failed to restore submission after resume failed",
+				"submission", jobID, "error", saveErr)
+		}
+		return e.InternalServerError("Failed to resume submission", err)
+	}
+	return e.JSON(http.StatusAccepted, map[string]string{"jobid": jobID, "status": string(jobs.StatusQueued)})
+}
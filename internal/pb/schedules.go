@@ -0,0 +1,154 @@
+package pb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aligndx/aligndx/internal/jobs"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/cron"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// bindSchedules keeps a cron job for every enabled schedule. Each run creates a
+// submission record, which is queued like any other submission.
+func bindSchedules(pb *pocketbase.PocketBase) {
+	validate := func(e *core.RecordRequestEvent) error {
+		if _, err := cron.NewSchedule(e.Record.GetString("cron")); err != nil {
+			return e.BadRequestError("Invalid cron expression", err)
+		}
+		return e.Next()
+	}
+	pb.OnRecordCreateRequest("schedules").BindFunc(validate)
+	pb.OnRecordUpdateRequest("schedules").BindFunc(validate)
+
+	pb.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		records, err := se.App.FindAllRecords("schedules", dbx.HashExp{"enabled": true})
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := registerSchedule(se.App, record); err != nil {
+				se.App.Logger().Error("Failed to register schedule", "schedule", record.Id, "error", err)
+			}
+		}
+		return se.Next()
+	})
+
+	pb.OnRecordAfterCreateSuccess("schedules").BindFunc(func(e *core.RecordEvent) error {
+		if err := registerSchedule(e.App, e.Record); err != nil {
+			e.App.Logger().Error("Failed to register schedule", "schedule", e.Record.Id, "error", err)
+		}
+		return e.Next()
+	})
+	pb.OnRecordAfterUpdateSuccess("schedules").BindFunc(func(e *core.RecordEvent) error {
+		if err := registerSchedule(e.App, e.Record); err != nil {
+			e.App.Logger().Error("Failed to register schedule", "schedule", e.Record.Id, "error", err)
+		}
+		return e.Next()
+	})
+	pb.OnRecordAfterDeleteSuccess("schedules").BindFunc(func(e *core.RecordEvent) error {
+		e.App.Cron().Remove(scheduleJobID(e.Record.Id))
+		return e.Next()
+	})
+}
+
+// scheduleJobID returns the cron job ID of a schedule.
+func scheduleJobID(scheduleID string) string {
+	return "schedule_" + scheduleID
+}
+
+// registerSchedule adds or replaces the cron job of a schedule, or removes it if the schedule is disabled.
+func registerSchedule(app core.App, schedule *core.Record) error {
+	jobID := scheduleJobID(schedule.Id)
+	if !schedule.GetBool("enabled") {
+		app.Cron().Remove(jobID)
+		return nil
+	}
+
+	scheduleID := schedule.Id
+	return app.Cron().Add(jobID, schedule.GetString("cron"), func() {
+		if err := runSchedule(app, scheduleID); err != nil {
+			app.Logger().Error("Scheduled submission failed", "schedule", scheduleID, "error", err)
+		}
+	})
+}
+
+// runSchedule creates a submission from a schedule's parameter template. If the schedule
+// selects inputs, the run is skipped when no new data matches.
+func runSchedule(app core.App, scheduleID string) error {
+	schedule, err := app.FindRecordById("schedules", scheduleID)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+
+	params := map[string]interface{}{}
+	if raw := schedule.GetString("params"); raw != "" && raw != "null" {
+		if err := schedule.UnmarshalJSONField("params", &params); err != nil {
+			return fmt.Errorf("invalid parameter template: %w", err)
+		}
+	}
+
+	if param := schedule.GetString("input_param"); param != "" {
+		inputs, err := selectScheduleInputs(app, schedule, now)
+		if err != nil {
+			return err
+		}
+		if len(inputs) == 0 {
+			app.Logger().Info("Skipping scheduled submission with no new inputs", "schedule", scheduleID)
+			return nil
+		}
+		params[param] = inputs
+	}
+
+	submissions, err := app.FindCollectionByNameOrId("submissions")
+	if err != nil {
+		return err
+	}
+	submission := core.NewRecord(submissions)
+	submission.Set("user", schedule.GetString("user"))
+	submission.Set("workflow", schedule.GetString("workflow"))
+	submission.Set("name", fmt.Sprintf("%s %s", schedule.GetString("name"), now.Format("2006-01-02 15:04")))
+	submission.Set("params", params)
+	submission.Set("status", string(jobs.StatusCreated))
+	if err := app.Save(submission); err != nil {
+		return fmt.Errorf("failed to create submission: %w", err)
+	}
+
+	schedule.Set("last_run", now)
+	return app.Save(schedule)
+}
+
+// selectScheduleInputs returns the IDs of the schedule owner's files, with the schedule's
+// tag if it has one, created since the schedule last ran, or since it was created if it has
+// not run yet, and up to now. Files created after now are left to the next run, which starts
+// from now.
+func selectScheduleInputs(app core.App, schedule *core.Record, now time.Time) ([]string, error) {
+	since := schedule.GetDateTime("last_run")
+	if since.IsZero() {
+		since = schedule.GetDateTime("created")
+	}
+	filter := "user ?= {:user} && type = 'file' && created > {:since} && created <= {:now}"
+	params := dbx.Params{
+		"user":  schedule.GetString("user"),
+		"since": since.String(),
+		"now":   now.Format(types.DefaultDateLayout),
+	}
+	if tag := schedule.GetString("tag"); tag != "" {
+		filter += " && tag = {:tag}"
+		params["tag"] = tag
+	}
+
+	records, err := app.FindRecordsByFilter("data", filter, "created", 0, 0, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select inputs: %w", err)
+	}
+	ids := make([]string, len(records))
+	for i, record := range records {
+		ids[i] = record.Id
+	}
+	return ids, nil
+}
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	_ "github.com/aligndx/aligndx/internal/migrations"
 	"github.com/nats-io/nats.go/jetstream"
@@ -15,7 +17,9 @@ import (
 	"github.com/aligndx/aligndx/internal/config"
 	"github.com/aligndx/aligndx/internal/jobs"
 	"github.com/aligndx/aligndx/internal/jobs/handlers/workflow"
+	"github.com/aligndx/aligndx/internal/jobs/mq"
 	"github.com/aligndx/aligndx/internal/logger"
+	"github.com/aligndx/aligndx/internal/resources"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/cmd"
@@ -42,8 +46,37 @@ func CreatePbApp(rootcmd *cobra.Command) (*pocketbase.PocketBase, error) {
 }
 
 func ConfigurePbApp(ctx context.Context, pb *pocketbase.PocketBase, cfg *config.Config, jobService jobs.JobServiceInterface) error {
+	bindSchedules(pb)
+	bindArchives(ctx, pb, jobService)
+
 	pb.OnRecordCreateRequest("submissions").BindFunc(func(e *core.RecordRequestEvent) error {
 		e.Record.Set("status", string(jobs.StatusCreated))
+
+		workflowRecord, err := e.App.FindRecordById("workflows", e.Record.GetString("workflow"))
+		if err != nil {
+			return e.BadRequestError("Unknown workflow", err)
+		}
+		limit, override := workflowRecord.GetInt("max_runtime"), e.Record.GetInt("max_runtime")
+		if limit > 0 && override > limit {
+			return e.BadRequestError(fmt.Sprintf("max_runtime cannot exceed the workflow limit of %d minutes", limit), nil)
+		}
+
+		if parentID := e.Record.GetString("depends_on"); parentID != "" {
+			parent, err := e.App.FindRecordById("submissions", parentID)
+			if err != nil || parent.GetString("user") != e.Record.GetString("user") {
+				return e.BadRequestError("Unknown parent submission", err)
+			}
+			// Inputs mapped from the parent's outputs are only known once it completes.
+			return e.Next()
+		}
+
+		inputs, err := submissionInputs(e.Record, workflowRecord)
+		if err != nil {
+			return e.BadRequestError("Invalid params", err)
+		}
+		if err := jobService.Validate("workflow", inputs); err != nil {
+			return e.BadRequestError(err.Error(), err)
+		}
 		return e.Next()
 	})
 
@@ -56,58 +89,54 @@ func ConfigurePbApp(ctx context.Context, pb *pocketbase.PocketBase, cfg *config.
 				pb.App.Logger().Error(err.Error())
 				return
 			}
-			record, err := e.App.FindRecordById("submissions", event.MetaData.JobID)
+			if handled, err := setArchiveStatus(e.App, event.MetaData); handled {
+				if err != nil {
+					pb.App.Logger().Error(err.Error())
+				}
+				return
+			}
+			record, applied, err := applySubmissionStatus(e.App, msg, event)
 			if err != nil {
 				pb.App.Logger().Error(err.Error())
 				return
 			}
-			record.Set("status", string(event.MetaData.Status))
-			if err = e.App.Save(record); err != nil {
-				pb.App.Logger().Error(err.Error())
+			if !applied {
 				return
 			}
+			if event.MetaData.Status.IsTerminal() {
+				releaseDependents(ctx, e.App, jobService, record.Id)
+			}
+			if batchID := record.GetString("batch"); batchID != "" {
+				if err := updateBatch(e.App, batchID); err != nil {
+					pb.App.Logger().Error(err.Error())
+				}
+			}
 		})
 
 		if err != nil {
 			return err
 		}
 
+		if err := bindProgress(ctx, e.App, jobService); err != nil {
+			return err
+		}
+		if err := bindEventRecorder(ctx, e.App, jobService); err != nil {
+			return err
+		}
+
 		return e.Next()
 	})
 
 	pb.OnRecordAfterCreateSuccess("submissions").BindFunc(func(e *core.RecordEvent) error {
-		record := e.Record
-		jobID := e.Record.Id
-		userID := record.GetString("user")
-
-		result := map[string]interface{}{}
-		record.UnmarshalJSONField("params", &result)
-		workflowRecordID := record.GetString("workflow")
-
-		workflowRecord, err := e.App.FindRecordById("workflows", workflowRecordID)
-
-		if err != nil {
-			return err
+		if e.Record.GetString("depends_on") != "" {
+			if err := startDependent(ctx, e.App, jobService, e.Record); err != nil {
+				return err
+			}
+			return e.Next()
 		}
-
-		var schema map[string]interface{}
-		if err := workflowRecord.UnmarshalJSONField("schema", &schema); err != nil {
+		if err := queueSubmission(ctx, e.App, jobService, e.Record); err != nil {
 			return err
 		}
-		// Use the retrieved data to create a WorkflowInputs object
-		workflowInputs := workflow.WorkflowInputs{
-			Name:       record.GetString("name"),
-			Repository: workflowRecord.GetString("repository"),
-			Schema:     schema,
-			Inputs:     result,
-			JobID:      jobID,
-			UserID:     userID,
-		}
-
-		queueErr := jobService.Queue(ctx, jobID, workflowInputs, "workflow")
-		if queueErr != nil {
-			return queueErr
-		}
 		return e.Next()
 	})
 
@@ -121,11 +150,205 @@ func ConfigurePbApp(ctx context.Context, pb *pocketbase.PocketBase, cfg *config.
 			sseHandler(e.Response, e.Request, jobService, jobID)
 			return nil
 		})
+
+		se.Router.POST("/jobs/cancel/{jobId}", func(e *core.RequestEvent) error {
+			return cancelHandler(ctx, e, jobService)
+		}).Bind(apis.RequireAuth())
+
+		se.Router.POST("/jobs/resume/{jobId}", func(e *core.RequestEvent) error {
+			return resumeHandler(ctx, e, jobService)
+		}).Bind(apis.RequireAuth())
+
+		se.Router.GET("/jobs/health", func(e *core.RequestEvent) error {
+			health := jobService.MQHealth()
+			status := http.StatusOK
+			if !health.Healthy {
+				status = http.StatusServiceUnavailable
+			}
+			return e.JSON(status, map[string]interface{}{"mq": health})
+		})
+
+		se.Router.GET("/jobs/reports/compute", computeReportHandler).Bind(apis.RequireSuperuserAuth())
+
+		se.Router.POST("/jobs/batches", func(e *core.RequestEvent) error {
+			return batchHandler(e, jobService)
+		}).Bind(apis.RequireAuth("users"))
+
+		dlq := se.Router.Group("/jobs/dlq").Bind(apis.RequireSuperuserAuth())
+		dlq.GET("", func(e *core.RequestEvent) error {
+			entries, err := jobService.ListDeadLetters(ctx)
+			if err != nil {
+				return e.InternalServerError("Failed to list dead-lettered jobs", err)
+			}
+			return e.JSON(http.StatusOK, entries)
+		})
+		dlq.GET("/{jobId}", func(e *core.RequestEvent) error {
+			entry, err := jobService.GetDeadLetter(ctx, e.Request.PathValue("jobId"))
+			if errors.Is(err, jobs.ErrDeadLetterNotFound) {
+				return e.NotFoundError("Dead-lettered job not found", err)
+			}
+			if err != nil {
+				return e.InternalServerError("Failed to get dead-lettered job", err)
+			}
+			return e.JSON(http.StatusOK, entry)
+		})
+		dlq.POST("/{jobId}/requeue", func(e *core.RequestEvent) error {
+			jobID := e.Request.PathValue("jobId")
+			err := jobService.RequeueDeadLetter(ctx, jobID)
+			if errors.Is(err, jobs.ErrDeadLetterNotFound) {
+				return e.NotFoundError("Dead-lettered job not found", err)
+			}
+			if err != nil {
+				return e.InternalServerError("Failed to requeue dead-lettered job", err)
+			}
+			return e.JSON(http.StatusAccepted, map[string]string{"jobid": jobID, "status": string(jobs.StatusQueued)})
+		})
+
+		registry := jobService.WatchWorkers(ctx)
+		workers := se.Router.Group("/jobs/workers").Bind(apis.RequireSuperuserAuth())
+		workers.GET("", func(e *core.RequestEvent) error {
+			return e.JSON(http.StatusOK, registry.Workers())
+		})
+		workers.GET("/{workerId}", func(e *core.RequestEvent) error {
+			info, ok := registry.Worker(e.Request.PathValue("workerId"))
+			if !ok {
+				return e.NotFoundError("Worker not found", nil)
+			}
+			return e.JSON(http.StatusOK, info)
+		})
+		workers.GET("/{workerId}/jobs", func(e *core.RequestEvent) error {
+			return controlHandler(ctx, e, jobService, jobs.ControlRequest{Command: jobs.ControlListJobs})
+		})
+		workers.GET("/{workerId}/jobs/{jobId}/output", func(e *core.RequestEvent) error {
+			lines, _ := strconv.Atoi(e.Request.URL.Query().Get("lines"))
+			return controlHandler(ctx, e, jobService, jobs.ControlRequest{
+				Command: jobs.ControlJobOutput,
+				JobID:   e.Request.PathValue("jobId"),
+				Lines:   lines,
+			})
+		})
+		workers.PUT("/{workerId}/log-level", func(e *core.RequestEvent) error {
+			var body struct {
+				Level string `json:"level"`
+			}
+			if err := e.BindBody(&body); err != nil {
+				return e.BadRequestError("Invalid request body", err)
+			}
+			return controlHandler(ctx, e, jobService, jobs.ControlRequest{Command: jobs.ControlSetLogLevel, Level: body.Level})
+		})
+		workers.POST("/{workerId}/pause", func(e *core.RequestEvent) error {
+			return controlHandler(ctx, e, jobService, jobs.ControlRequest{Command: jobs.ControlPause})
+		})
+		workers.POST("/{workerId}/resume", func(e *core.RequestEvent) error {
+			return controlHandler(ctx, e, jobService, jobs.ControlRequest{Command: jobs.ControlResume})
+		})
 		return se.Next()
 	})
 	return nil
 }
 
+// submissionInputs builds the workflow job inputs of a submission record.
+func submissionInputs(record *core.Record, workflowRecord *core.Record) (workflow.WorkflowInputs, error) {
+	result := map[string]interface{}{}
+	if raw := record.GetString("params"); raw != "" && raw != "null" {
+		if err := record.UnmarshalJSONField("params", &result); err != nil {
+			return workflow.WorkflowInputs{}, err
+		}
+	}
+
+	var schema map[string]interface{}
+	if err := workflowRecord.UnmarshalJSONField("schema", &schema); err != nil {
+		return workflow.WorkflowInputs{}, err
+	}
+	return workflow.WorkflowInputs{
+		Name:       record.GetString("name"),
+		Repository: workflowRecord.GetString("repository"),
+		Schema:     schema,
+		Inputs:     result,
+		JobID:      record.Id,
+		UserID:     record.GetString("user"),
+	}, nil
+}
+
+// queueSubmission queues the workflow run of a submission record.
+func queueSubmission(ctx context.Context, app core.App, jobService jobs.JobServiceInterface, record *core.Record) error {
+	workflowInputs, opts, err := submissionJob(app, record)
+	if err != nil {
+		return err
+	}
+	return jobService.Queue(ctx, record.Id, workflowInputs, "workflow", opts...)
+}
+
+// submissionJob returns the inputs and queue options of a submission's workflow run.
+func submissionJob(app core.App, record *core.Record) (workflow.WorkflowInputs, []jobs.QueueOption, error) {
+	workflowRecord, err := app.FindRecordById("workflows", record.GetString("workflow"))
+	if err != nil {
+		return workflow.WorkflowInputs{}, nil, err
+	}
+
+	workflowInputs, err := submissionInputs(record, workflowRecord)
+	if err != nil {
+		return workflow.WorkflowInputs{}, nil, err
+	}
+
+	priority := jobs.ParsePriority(record.GetString("priority"))
+	needs := resources.Resources{
+		CPUs:     workflowRecord.GetInt("cpus"),
+		MemoryGB: workflowRecord.GetInt("memory"),
+	}
+	return workflowInputs, []jobs.QueueOption{
+		jobs.WithPriority(priority), jobs.WithUser(record.GetString("user")), jobs.WithResources(needs),
+		jobs.WithTimeout(maxRuntime(workflowRecord, record)),
+	}, nil
+}
+
+// maxRuntime returns how long a submission may run: its own limit if it set one,
+// otherwise the workflow's. Zero means no limit.
+func maxRuntime(workflowRecord *core.Record, submission *core.Record) time.Duration {
+	minutes := submission.GetInt("max_runtime")
+	if minutes <= 0 {
+		minutes = workflowRecord.GetInt("max_runtime")
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// cancelHandler cancels a submission owned by the authenticated user.
+func cancelHandler(ctx context.Context, e *core.RequestEvent, jobService jobs.JobServiceInterface) error {
+	jobID := e.Request.PathValue("jobId")
+	record, err := e.App.FindRecordById("submissions", jobID)
+	if err != nil {
+		return e.NotFoundError("Submission not found", err)
+	}
+	if !e.HasSuperuserAuth() && record.GetString("user") != e.Auth.Id {
+		return e.ForbiddenError("Only the submission owner can cancel it", nil)
+	}
+
+	status := jobs.JobStatus(record.GetString("status"))
+	if status.IsTerminal() {
+		return e.BadRequestError(fmt.Sprintf("Submission is already %s", status), nil)
+	}
+
+	if err := jobService.Cancel(ctx, jobID); err != nil {
+		return e.InternalServerError("Failed to cancel submission", err)
+	}
+	return e.JSON(http.StatusAccepted, map[string]string{"jobid": jobID, "status": string(jobs.StatusCancelled)})
+}
+
+// controlHandler sends a control request to the worker in the path and returns its answer.
+func controlHandler(ctx context.Context, e *core.RequestEvent, jobService jobs.JobServiceInterface, req jobs.ControlRequest) error {
+	resp, err := jobService.Control(ctx, e.Request.PathValue("workerId"), req)
+	if errors.Is(err, jobs.ErrWorkerUnreachable) {
+		return e.NotFoundError("Worker not reachable", err)
+	}
+	if errors.Is(err, jobs.ErrControlRejected) {
+		return e.BadRequestError(resp.Error, err)
+	}
+	if err != nil {
+		return e.InternalServerError("Failed to reach worker", err)
+	}
+	return e.JSON(http.StatusOK, resp)
+}
+
 func sseHandler(w http.ResponseWriter, r *http.Request, jobService jobs.JobServiceInterface, jobID string) {
 	// Set SSE headers
 	w.Header().Set("Content-Type", "text/event-stream")
@@ -148,13 +371,22 @@ func sseHandler(w http.ResponseWriter, r *http.Request, jobService jobs.JobServi
 
 	subject := fmt.Sprintf("%s.>", jobID)
 
+	// Replay every event, unless a reconnecting client reports the last one it received.
+	var opts []mq.SubscribeOption
+	if lastID, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+		opts = append(opts, mq.StartAtSequence(lastID+1))
+	}
+
 	// Subscribe to job events; jobService.SubscribeToJob should invoke the callback with new messages.
 	err := jobService.ReplaySubscribe(clientCtx, subject, func(msg jetstream.Msg) {
-		// Write SSE data to the response in the required format
+		// Write SSE data to the response in the required format, using the stream sequence as the event ID
+		if meta, err := msg.Metadata(); err == nil {
+			fmt.Fprintf(w, "id: %d\n", meta.Sequence.Stream)
+		}
 		fmt.Fprintf(w, "data: %s\n\n", msg.Data())
 		// Flush the data immediately so it reaches the client
 		flusher.Flush()
-	})
+	}, opts...)
 
 	if err != nil {
 		// Handle subscription error
@@ -179,6 +411,7 @@ func StartPBServer(ctx context.Context, pb *pocketbase.PocketBase, args []string
 		log.Fatal("Failed to setup job service", map[string]interface{}{"error": err})
 		return err
 	}
+	jobs.RegisterDefaultJobs(jobService)
 
 	err = ConfigurePbApp(ctx, pb, cfg, jobService)
 	if err != nil {
@@ -0,0 +1,117 @@
+package pb
+
+import (
+	"time"
+
+	"github.com/aligndx/aligndx/internal/jobs"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// statusChange is an entry in a submission's status history.
+type statusChange struct {
+	Status jobs.JobStatus `json:"status"`
+	Reason string         `json:"reason,omitempty"`
+	At     string         `json:"at"`
+	Seq    uint64         `json:"seq"`
+}
+
+// applySubmissionStatus records a status event on its submission and reports whether it was
+// applied. Events older than the last one applied, judged by stream sequence, and events that
+// are not a legal transition from the current status are rejected and logged.
+func applySubmissionStatus(app core.App, msg jetstream.Msg, event jobs.Event[jobs.StatusEventMetadata]) (*core.Record, bool, error) {
+	meta, err := msg.Metadata()
+	if err != nil {
+		return nil, false, err
+	}
+	published, err := types.ParseDateTime(meta.Timestamp)
+	if err != nil {
+		return nil, false, err
+	}
+
+	submissionMu.Lock()
+	defer submissionMu.Unlock()
+
+	record, err := app.FindRecordById("submissions", event.MetaData.JobID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	current, next := jobs.JobStatus(record.GetString("status")), event.MetaData.Status
+	// A lower sequence published later means the stream was reset, not that the event is stale.
+	// Publish times are compared at the millisecond precision they are stored with.
+	seq, lastSeq, lastAt := meta.Sequence.Stream, uint64(record.GetInt("status_seq")), record.GetDateTime("status_at")
+	if seq == lastSeq || (seq < lastSeq && !published.Time().Truncate(time.Millisecond).After(lastAt.Time())) {
+		app.Logger().Warn("Ignoring stale status event",
+			"submission", record.Id, "status", next, "seq", meta.Sequence.Stream, "last_seq", lastSeq)
+		return record, false, nil
+	}
+	if !current.CanTransitionTo(next) {
+		app.Logger().Warn("Rejecting illegal status transition",
+			"submission", record.Id, "from", current, "to", next, "seq", meta.Sequence.Stream)
+		return record, false, nil
+	}
+
+	var history []statusChange
+	if err := record.UnmarshalJSONField("status_history", &history); err != nil {
+		history = nil
+	}
+	// Repeated statuses only make the history when their reason changes.
+	if n := len(history); n == 0 || history[n-1].Status != next || history[n-1].Reason != event.MetaData.Reason {
+		history = append(history, statusChange{
+			Status: next,
+			Reason: event.MetaData.Reason,
+			At:     event.TimeStamp,
+			Seq:    meta.Sequence.Stream,
+		})
+	}
+
+	recordTiming(record, current, next, event.MetaData.Worker, published)
+	// Every attempt starts a new Nextflow run, whose task IDs start over, so its progress does too.
+	if next == jobs.StatusProcessing && current != next {
+		record.Set("progress", nil)
+	}
+	record.Set("status", string(next))
+	record.Set("status_seq", meta.Sequence.Stream)
+	record.Set("status_at", published)
+	record.Set("status_history", history)
+	if err := saveSubmissionFields(app, record, "status", "status_seq", "status_at", "status_history", "progress",
+		"queued_at", "started_at", "finished_at", "worker"); err != nil {
+		return nil, false, err
+	}
+	return record, true, nil
+}
+
+// recordTiming keeps a submission's lifecycle times, and the worker running it, up to date
+// with a status change published at the given time.
+func recordTiming(record *core.Record, current, next jobs.JobStatus, worker string, at types.DateTime) {
+	switch {
+	case next == jobs.StatusQueued:
+		// A finished job queued again is a new run. Otherwise only the first queued status
+		// counts, as jobs handed back by a worker or held back by limits are queued again.
+		if current.IsTerminal() {
+			resetTiming(record, at)
+		} else if record.GetDateTime("queued_at").IsZero() {
+			record.Set("queued_at", at)
+		}
+	case next == jobs.StatusProcessing:
+		// Retries and redeliveries continue the run that started first.
+		if record.GetDateTime("started_at").IsZero() {
+			record.Set("started_at", at)
+		}
+		if worker != "" {
+			record.Set("worker", worker)
+		}
+	case next.IsTerminal():
+		record.Set("finished_at", at)
+	}
+}
+
+// resetTiming clears the lifecycle times of a submission queued to run again at the given time.
+func resetTiming(record *core.Record, at types.DateTime) {
+	record.Set("queued_at", at)
+	record.Set("started_at", nil)
+	record.Set("finished_at", nil)
+	record.Set("worker", "")
+}
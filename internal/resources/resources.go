@@ -0,0 +1,67 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// Resources is an amount of CPU and memory, either needed by a job or available on a worker.
+type Resources struct {
+	CPUs     int `json:"cpus,omitempty"`
+	MemoryGB int `json:"memory_gb,omitempty"`
+}
+
+// System returns the logical CPUs and available memory of the current machine.
+func System() (Resources, error) {
+	// Get total logical CPUs
+	numCPUs := runtime.NumCPU()
+
+	// Get available memory in GB
+	memStats, err := mem.VirtualMemory()
+	if err != nil {
+		return Resources{}, fmt.Errorf("failed to get memory stats: %w", err)
+	}
+	availableMemoryGB := memStats.Available / (1024 * 1024 * 1024) // Convert to GB
+
+	return Resources{CPUs: numCPUs, MemoryGB: int(availableMemoryGB)}, nil
+}
+
+// IsZero reports whether no resources were declared.
+func (r Resources) IsZero() bool {
+	return r.CPUs == 0 && r.MemoryGB == 0
+}
+
+// Fits reports whether r fits within available.
+func (r Resources) Fits(available Resources) bool {
+	return r.CPUs <= available.CPUs && r.MemoryGB <= available.MemoryGB
+}
+
+// Add returns the sum of r and other.
+func (r Resources) Add(other Resources) Resources {
+	return Resources{CPUs: r.CPUs + other.CPUs, MemoryGB: r.MemoryGB + other.MemoryGB}
+}
+
+// Sub returns r minus other.
+func (r Resources) Sub(other Resources) Resources {
+	return Resources{CPUs: r.CPUs - other.CPUs, MemoryGB: r.MemoryGB - other.MemoryGB}
+}
+
+func (r Resources) String() string {
+	return fmt.Sprintf("%d CPUs, %d GB", r.CPUs, r.MemoryGB)
+}
+
+type reservationKey struct{}
+
+// WithReservation returns a context carrying the resources reserved for a job.
+func WithReservation(ctx context.Context, r Resources) context.Context {
+	return context.WithValue(ctx, reservationKey{}, r)
+}
+
+// ReservationFromContext returns the resources reserved for the job running under ctx, if any.
+func ReservationFromContext(ctx context.Context) (Resources, bool) {
+	r, ok := ctx.Value(reservationKey{}).(Resources)
+	return r, ok
+}
@@ -0,0 +1,4 @@
+package version
+
+// Version will be injected by GoReleaser during build time
+var Version = "dev"
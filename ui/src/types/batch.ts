@@ -0,0 +1,20 @@
+import { Workflow } from "./workflow";
+
+export enum BatchStatus {
+    Running = "running",
+    Completed = "completed",
+    Failed = "failed"
+}
+
+export type Batch = {
+    id: string;
+    user: string;
+    workflow: string | Workflow;
+    name: string;
+    params: any;
+    total: number;
+    counts: Record<string, number>;
+    status: BatchStatus;
+    created: Date;
+    updated: Date
+};
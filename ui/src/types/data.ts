@@ -7,6 +7,8 @@ export type Data = {
     parent?: string;
     user?: string;
     submission?: string;
+    status?: string;
+    status_reason?: string;
     readonly created?: Date;
     readonly updated?: Date
 };
@@ -4,6 +4,10 @@ export type Event = {
     message?: string;
     timestamp?: string;
     metadata?: Record<string, any>;
+    submission?: string;
+    subject?: string;
+    stream_seq?: number;
+    published?: string;
     readonly created?: Date;
     readonly updated?: Date
 };
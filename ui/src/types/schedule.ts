@@ -0,0 +1,16 @@
+import { Workflow } from "./workflow";
+
+export type Schedule = {
+    id: string;
+    user: string;
+    workflow: string | Workflow;
+    name: string;
+    cron: string;
+    params: any;
+    input_param?: string;
+    tag?: string;
+    enabled: boolean;
+    last_run?: Date;
+    created: Date;
+    updated: Date
+};
@@ -1,5 +1,4 @@
 import { Data } from "./data";
-import { Event } from "./event";
 import { Workflow } from "./workflow";
 
 export enum Status {
@@ -7,9 +6,49 @@ export enum Status {
     Queued = "queued",
     Processing = "processing",
     Completed = "completed",
-    Error = "error"
+    Error = "error",
+    Cancelled = "cancelled",
+    Retrying = "retrying",
+    Lost = "lost",
+    Timeout = "timeout",
+    Waiting = "waiting"
 }
 
+export enum Priority {
+    Urgent = "urgent",
+    Normal = "normal",
+    Bulk = "bulk"
+}
+
+export type ProcessProgress = {
+    submitted: number;
+    running: number;
+    completed: number;
+    failed: number;
+    cached: number;
+};
+
+export type Progress = ProcessProgress & {
+    percent: number;
+    processes: Record<string, ProcessProgress>;
+};
+
+export type StatusChange = {
+    status: Status;
+    reason?: string;
+    at: string;
+    seq: number;
+};
+
+export type Compute = {
+    cpu_hours: number;
+    peak_memory_bytes: number;
+    tasks: number;
+    completed: number;
+    failed: number;
+    cached: number;
+};
+
 export type Submission = {
     id: string;
     user: string;
@@ -17,7 +56,18 @@ export type Submission = {
     name: string;
     inputs: any;
     status?: Status;
-    events?: Event;
+    priority?: Priority;
+    max_runtime?: number;
+    depends_on?: string | Submission;
+    input_mapping?: Record<string, string>;
+    batch?: string;
+    progress?: Progress;
+    status_history?: StatusChange[];
+    queued_at?: string;
+    started_at?: string;
+    finished_at?: string;
+    worker?: string;
+    compute?: Compute;
     outputs: string[] | Data[];
     created: Date;
     updated: Date
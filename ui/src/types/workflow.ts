@@ -4,6 +4,9 @@ export type Workflow = {
     repository: string;
     description: string;
     schema: any;
+    cpus?: number;
+    memory?: number;
+    max_runtime?: number;
     created: Date;
     updated: Date
 };